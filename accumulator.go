@@ -0,0 +1,224 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrIncompleteStream is returned by MessageAccumulator.Final when the stream ended before
+// its message_stop event.
+var ErrIncompleteStream = errors.New("message stream ended before message_stop")
+
+// maxSkippedBlocks is how far past the last block the index of an event may be. Blocks are
+// streamed in order, so a larger index comes from a broken stream.
+const maxSkippedBlocks = 64
+
+// MessageAccumulator builds the MessageResponse of a stream from its events, so that
+// streamed and non-streamed responses can be handled by the same code.
+//
+//	acc := NewMessageAccumulator()
+//	for stream.Next() {
+//		if err := acc.Apply(stream.Current()); err != nil {
+//			...
+//		}
+//	}
+//	message, err := acc.Final()
+//
+// MessageSSEDecoder and MessageStream keep an accumulator of their own, see
+// MessageStream.Final.
+type MessageAccumulator struct {
+	message MessageResponse
+	// inputs parses the input_json_delta fragments of the tool_use blocks that have not
+	// stopped yet.
+	inputs  map[int]*PartialJSONParser
+	stopped bool
+}
+
+// NewMessageAccumulator creates a new MessageAccumulator.
+func NewMessageAccumulator() *MessageAccumulator {
+	return &MessageAccumulator{inputs: make(map[int]*PartialJSONParser)}
+}
+
+// Apply updates the message with an event decoded by MessageSSEDecoder. Deltas for blocks
+// that did not start are applied to an empty block of the matching type. It fails when the
+// index of a block is negative or far past the last block, and when the input of a tool_use
+// block is not valid JSON once the block stops.
+func (a *MessageAccumulator) Apply(event *MessageEventPayload) error {
+	if event == nil {
+		return nil
+	}
+
+	switch data := event.Data.Data.(type) {
+	case MessageStart:
+		a.message = data.Message
+		a.message.Content = append([]ContentBlock(nil), data.Message.Content...)
+		a.inputs = make(map[int]*PartialJSONParser)
+		a.stopped = false
+	case ContentBlockStart:
+		if err := a.checkIndex(data.Index); err != nil {
+			return err
+		}
+		*a.block(data.Index, data.ContentBlock.Type) = data.ContentBlock
+	case ContentBlockDelta:
+		if err := a.checkIndex(data.Index); err != nil {
+			return err
+		}
+		a.applyDelta(data.Index, data.Delta)
+	case ContentBlockStop:
+		if err := a.checkIndex(data.Index); err != nil {
+			return err
+		}
+		return a.stopBlock(data.Index)
+	case MessageDelta:
+		a.message.StopReason = data.Delta.StopReason
+		a.message.StopSequence = data.Delta.StopSequence
+		a.applyUsage(data.Usage)
+	case MessageStopData:
+		a.stopped = true
+	}
+
+	return nil
+}
+
+// checkIndex rejects block indexes that are negative or more than maxSkippedBlocks past the
+// last block.
+func (a *MessageAccumulator) checkIndex(index int) error {
+	if index < 0 || index > len(a.message.Content)+maxSkippedBlocks {
+		return fmt.Errorf("content block %d: index out of range with %d blocks", index, len(a.message.Content))
+	}
+	return nil
+}
+
+// applyUsage applies the cumulative usage of a message_delta event. Only the output tokens are
+// always reported; the other counts are kept when they are missing.
+func (a *MessageAccumulator) applyUsage(usage Usage) {
+	a.message.Usage.OutputTokens = usage.OutputTokens
+	if usage.InputTokens > 0 {
+		a.message.Usage.InputTokens = usage.InputTokens
+	}
+	if usage.CacheCreationInputTokens > 0 {
+		a.message.Usage.CacheCreationInputTokens = usage.CacheCreationInputTokens
+	}
+	if usage.CacheReadInputTokens > 0 {
+		a.message.Usage.CacheReadInputTokens = usage.CacheReadInputTokens
+	}
+	if usage.CacheCreation != nil {
+		a.message.Usage.CacheCreation = usage.CacheCreation
+	}
+}
+
+// applyDelta appends a delta to its block.
+func (a *MessageAccumulator) applyDelta(index int, delta ContentDelta) {
+	switch delta.Type {
+	case "text_delta":
+		a.block(index, string(ContentTypeText)).Text += delta.Text
+	case "input_json_delta":
+		a.block(index, string(ContentTypeToolUse))
+		input, ok := a.inputs[index]
+		if !ok {
+			input = NewPartialJSONParser()
+			a.inputs[index] = input
+		}
+		input.write(delta.PartialJSON)
+	case "thinking_delta":
+		a.block(index, string(ContentTypeThinking)).Thinking += delta.Thinking
+	case "signature_delta":
+		a.block(index, string(ContentTypeThinking)).Signature = delta.Signature
+	case "citations_delta":
+		if delta.Citation != nil {
+			block := a.block(index, string(ContentTypeText))
+			block.Citations = append(block.Citations, *delta.Citation)
+		}
+	}
+}
+
+// stopBlock sets the input of a finished tool_use block from its fragments. A tool_use block
+// without input gets an empty object.
+func (a *MessageAccumulator) stopBlock(index int) error {
+	if index >= len(a.message.Content) {
+		return nil
+	}
+	block := &a.message.Content[index]
+
+	input, ok := a.inputs[index]
+	delete(a.inputs, index)
+
+	if ok && input.String() != "" {
+		raw := input.String()
+		if !json.Valid([]byte(raw)) {
+			return fmt.Errorf("content block %d: invalid tool input JSON", index)
+		}
+		block.Input = json.RawMessage(raw)
+	}
+	if block.Type == string(ContentTypeToolUse) && len(block.Input) == 0 {
+		block.Input = json.RawMessage("{}")
+	}
+
+	return nil
+}
+
+// input returns the parser of the input of a tool_use block that is still streaming, or nil.
+func (a *MessageAccumulator) input(index int) *PartialJSONParser {
+	return a.inputs[index]
+}
+
+// toolUse returns the stopped tool_use block at index along with its parsed input, or nil if
+// the block is not a tool_use block.
+func (a *MessageAccumulator) toolUse(index int) (*ContentBlock, map[string]any, error) {
+	if index < 0 || index >= len(a.message.Content) || a.message.Content[index].Type != string(ContentTypeToolUse) {
+		return nil, nil, nil
+	}
+	block := a.message.Content[index]
+
+	var input map[string]any
+	if err := json.Unmarshal(block.Input, &input); err != nil {
+		return nil, nil, fmt.Errorf("content block %d: invalid tool input JSON: %w", index, err)
+	}
+
+	return &block, input, nil
+}
+
+// block returns the block at index, adding empty blocks of the given type up to it.
+func (a *MessageAccumulator) block(index int, blockType string) *ContentBlock {
+	for len(a.message.Content) <= index {
+		a.message.Content = append(a.message.Content, ContentBlock{Type: blockType})
+	}
+	return &a.message.Content[index]
+}
+
+// Snapshot returns the message received so far. The input of a tool_use block that is still
+// streaming is the best-effort parse of its fragments, see PartialJSONParser.
+func (a *MessageAccumulator) Snapshot() MessageResponse {
+	message := a.message
+	message.Content = make([]ContentBlock, len(a.message.Content))
+	copy(message.Content, a.message.Content)
+
+	for i := range message.Content {
+		block := &message.Content[i]
+		block.Citations = append([]Citation(nil), block.Citations...)
+
+		input, ok := a.inputs[i]
+		if !ok {
+			continue
+		}
+		partial, err := input.Feed("")
+		if err != nil || partial.Value == nil {
+			continue
+		}
+		if input, err := json.Marshal(partial.Value); err == nil {
+			block.Input = input
+		}
+	}
+
+	return message
+}
+
+// Final returns the complete message. It fails when the message_stop event was not applied,
+// e.g. because the stream was interrupted.
+func (a *MessageAccumulator) Final() (MessageResponse, error) {
+	if !a.stopped {
+		return a.Snapshot(), ErrIncompleteStream
+	}
+	return a.Snapshot(), nil
+}
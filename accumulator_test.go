@@ -0,0 +1,239 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accumulatorStream is a stream with a thinking block, a cited text block and a tool_use block.
+const accumulatorStream = `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "content": [], "model": "claude-3-7-sonnet-20250219", "stop_reason": null, "stop_sequence": null, "usage": {"input_tokens": 25, "output_tokens": 1, "cache_read_input_tokens": 10}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "thinking", "thinking": ""}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "thinking_delta", "thinking": "Look it up"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "thinking_delta", "thinking": " in the docs."}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "signature_delta", "signature": "sig"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 1, "content_block": {"type": "text", "text": ""}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "citations_delta", "citation": {"type": "char_location", "cited_text": "Go is fast.", "document_index": 0, "start_char_index": 0, "end_char_index": 11}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "text_delta", "text": "Go is "}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "text_delta", "text": "fast."}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 1}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 2, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "search", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 2, "delta": {"type": "input_json_delta", "partial_json": "{\"query\": \"go"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 2, "delta": {"type": "input_json_delta", "partial_json": " speed\"}"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 2}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "tool_use", "stop_sequence": null}, "usage": {"output_tokens": 42}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`
+
+// accumulatorResponse is the non-streamed response matching accumulatorStream.
+const accumulatorResponse = `{
+	"id": "msg_1",
+	"type": "message",
+	"role": "assistant",
+	"model": "claude-3-7-sonnet-20250219",
+	"content": [
+		{"type": "thinking", "thinking": "Look it up in the docs.", "signature": "sig"},
+		{"type": "text", "text": "Go is fast.", "citations": [{"type": "char_location", "cited_text": "Go is fast.", "document_index": 0, "start_char_index": 0, "end_char_index": 11}]},
+		{"type": "tool_use", "id": "toolu_1", "name": "search", "input": {"query": "go speed"}}
+	],
+	"stop_reason": "tool_use",
+	"stop_sequence": null,
+	"usage": {"input_tokens": 25, "output_tokens": 42, "cache_read_input_tokens": 10}
+}`
+
+func TestMessageAccumulator(t *testing.T) {
+	decoder := NewMessageSSEDecoder(strings.NewReader(accumulatorStream))
+	acc := NewMessageAccumulator()
+
+	var snapshots []MessageResponse
+	for {
+		event, err := decoder.Decode()
+		require.NoError(t, err)
+		if event == nil {
+			break
+		}
+		require.NoError(t, acc.Apply(event))
+		snapshots = append(snapshots, acc.Snapshot())
+	}
+
+	final, err := acc.Final()
+	require.NoError(t, err)
+
+	var expected MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(accumulatorResponse), &expected))
+	assertSameMessage(t, expected, final)
+
+	// the decoder accumulates the same message
+	decoded, err := decoder.Accumulator().Final()
+	require.NoError(t, err)
+	assertSameMessage(t, expected, decoded)
+
+	// snapshots show the message as it streams, including partial tool input
+	assert.Equal(t, "Look it up", snapshots[2].Content[0].Thinking)
+	assert.Equal(t, "Go is ", snapshots[9].Content[1].Text)
+	assert.Len(t, snapshots[9].Content[1].Citations, 1)
+	assert.Equal(t, "msg_1", snapshots[9].ID)
+	assert.JSONEq(t, `{"query": "go"}`, string(snapshots[13].Content[2].Input))
+	assert.Empty(t, snapshots[13].StopReason)
+	assert.Equal(t, 1, snapshots[13].Usage.OutputTokens)
+
+	// snapshots are not changed by later events
+	assert.Len(t, snapshots[9].Content, 2)
+	assert.Equal(t, "Go is fast.", snapshots[10].Content[1].Text)
+}
+
+// assertSameMessage compares messages by their JSON encoding, as tool inputs may differ
+// in whitespace.
+func assertSameMessage(t *testing.T, expected, actual MessageResponse) {
+	expectedJSON, err := json.Marshal(expected)
+	require.NoError(t, err)
+	actualJSON, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
+
+func TestMessageAccumulator_Incomplete(t *testing.T) {
+	acc := NewMessageAccumulator()
+
+	// deltas of blocks that did not start are still applied
+	require.NoError(t, acc.Apply(&MessageEventPayload{Event: "content_block_delta", Data: EventData{Data: ContentBlockDelta{
+		Index: 1, Delta: ContentDelta{Type: "text_delta", Text: "Hi"},
+	}}}))
+	require.NoError(t, acc.Apply(nil))
+
+	message, err := acc.Final()
+	assert.EqualError(t, err, "message stream ended before message_stop")
+	require.Len(t, message.Content, 2)
+	assert.Equal(t, "Hi", message.Content[1].Text)
+
+	require.NoError(t, acc.Apply(&MessageEventPayload{Event: "content_block_delta", Data: EventData{Data: ContentBlockDelta{
+		Index: 2, Delta: ContentDelta{Type: "input_json_delta", PartialJSON: `{"a": }`},
+	}}}))
+	err = acc.Apply(&MessageEventPayload{Event: "content_block_stop", Data: EventData{Data: ContentBlockStop{Index: 2}}})
+	assert.EqualError(t, err, "content block 2: invalid tool input JSON")
+}
+
+func TestMessageStream_Final(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, accumulatorStream)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	// the message is accumulated from all the events, even those the options skip
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload(), DecodeOptions{ContentOnly: true})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var text strings.Builder
+	for stream.Next() {
+		text.WriteString(stream.Current().Data.Content)
+		assert.Equal(t, "msg_1", stream.Snapshot().ID)
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, "Go is fast.", text.String())
+
+	message, err := stream.Final()
+	require.NoError(t, err)
+
+	var expected MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(accumulatorResponse), &expected))
+	assertSameMessage(t, expected, message)
+}
+
+func TestMessageAccumulator_InvalidIndex(t *testing.T) {
+	testCases := []struct {
+		name          string
+		data          StreamEvent
+		expectedError string
+	}{
+		{
+			name:          "negative start",
+			data:          ContentBlockStart{Index: -1, ContentBlock: ContentBlock{Type: "text"}},
+			expectedError: "content block -1: index out of range with 0 blocks",
+		},
+		{
+			name:          "negative delta",
+			data:          ContentBlockDelta{Index: -1, Delta: ContentDelta{Type: "text_delta", Text: "Hi"}},
+			expectedError: "content block -1: index out of range with 0 blocks",
+		},
+		{
+			name:          "negative stop",
+			data:          ContentBlockStop{Index: -1},
+			expectedError: "content block -1: index out of range with 0 blocks",
+		},
+		{
+			name:          "huge delta",
+			data:          ContentBlockDelta{Index: 1 << 40, Delta: ContentDelta{Type: "input_json_delta", PartialJSON: "{"}},
+			expectedError: "content block 1099511627776: index out of range with 0 blocks",
+		},
+		{
+			name: "skipped blocks",
+			data: ContentBlockDelta{Index: maxSkippedBlocks, Delta: ContentDelta{Type: "text_delta", Text: "Hi"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			acc := NewMessageAccumulator()
+			err := acc.Apply(&MessageEventPayload{Data: EventData{Data: tc.data}})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Empty(t, acc.Snapshot().Content)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, acc.Snapshot().Content, maxSkippedBlocks+1)
+			}
+		})
+	}
+
+	// the decoder fails instead of panicking
+	decoder := NewMessageSSEDecoder(strings.NewReader("event: content_block_stop\ndata: {\"type\": \"content_block_stop\", \"index\": -3}\n\n"))
+	_, err := decoder.Decode()
+	assert.EqualError(t, err, "content block -3: index out of range with 0 blocks")
+}
@@ -0,0 +1,390 @@
+package anthrogo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const RequestTypeOrganizations = "organizations"
+
+// ErrNoAdminKey is returned by the admin methods of a client created without an admin key.
+var ErrNoAdminKey = errors.New("admin key not provided as option")
+
+// Organization roles of users and invites.
+const (
+	UserRoleUser      = "user"
+	UserRoleDeveloper = "developer"
+	UserRoleBilling   = "billing"
+	UserRoleAdmin     = "admin"
+)
+
+// Roles of the members of a workspace.
+const (
+	WorkspaceRoleUser      = "workspace_user"
+	WorkspaceRoleDeveloper = "workspace_developer"
+	WorkspaceRoleAdmin     = "workspace_admin"
+	WorkspaceRoleBilling   = "workspace_billing"
+)
+
+// Statuses of API keys.
+const (
+	APIKeyStatusActive   = "active"
+	APIKeyStatusInactive = "inactive"
+	APIKeyStatusArchived = "archived"
+)
+
+// Statuses of invites.
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusExpired  = "expired"
+	InviteStatusDeleted  = "deleted"
+)
+
+// WithAdminApiKey is an option to provide the admin key used by the Admin API methods, such
+// as ListWorkspaces. Admin keys start with "sk-ant-admin" and can only be created by
+// organization admins in the console. The admin key is never read from the environment, so
+// that only the clients meant to manage the organization can do so.
+func WithAdminApiKey(adminKey string) func(*Client) {
+	return func(c *Client) {
+		c.adminKey = adminKey
+	}
+}
+
+// PermissionError is returned by the Admin API methods when the API rejects the admin key
+// (401) or the key is not allowed to perform the request (403), e.g. when a regular API key
+// is given as the admin key. It unwraps to the underlying *APIError.
+type PermissionError struct {
+	*APIError
+}
+
+// Unauthenticated reports whether the key itself was rejected rather than the action.
+func (e *PermissionError) Unauthenticated() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// Unwrap returns the underlying *APIError.
+func (e *PermissionError) Unwrap() error {
+	return e.APIError
+}
+
+// doAdminJSON sends a request to an Admin API path, relative to /organizations, with the
+// admin key.
+func (c *Client) doAdminJSON(ctx context.Context, method, path string, payload, out any) error {
+	if c.adminKey == "" {
+		return ErrNoAdminKey
+	}
+
+	err := c.doJSON(ctx, method, RequestTypeOrganizations+"/"+path, payload, out, func(req *http.Request) {
+		req.Header.Set("x-api-key", c.adminKey)
+	})
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return &PermissionError{APIError: apiErr}
+	}
+	return err
+}
+
+// adminPath joins the segments of a path, escaping the IDs among them.
+func adminPath(segments ...string) string {
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// listAdmin fetches a page of an Admin API list with additional filters.
+func listAdmin[T any](ctx context.Context, c *Client, path string, opts ListOptions, filters url.Values) (Page[T], error) {
+	var page Page[T]
+
+	values := opts.values()
+	for key, value := range filters {
+		values[key] = value
+	}
+
+	err := c.doAdminJSON(ctx, http.MethodGet, withQuery(path, values), nil, &page)
+	return page, err
+}
+
+// Users
+
+// User is a member of the organization.
+type User struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ListUsers returns a page of the users of the organization. When email is not empty only
+// the user with that email is returned.
+func (c *Client) ListUsers(ctx context.Context, opts ListOptions, email string) (Page[User], error) {
+	filters := url.Values{}
+	if email != "" {
+		filters.Set("email", email)
+	}
+	return listAdmin[User](ctx, c, "users", opts, filters)
+}
+
+// IterateUsers returns an iterator over all the users of the organization.
+func (c *Client) IterateUsers(ctx context.Context, opts ListOptions) *PageIterator[User] {
+	return newPageIterator(ctx, opts, func(ctx context.Context, opts ListOptions) (Page[User], error) {
+		return c.ListUsers(ctx, opts, "")
+	})
+}
+
+// GetUser returns a user of the organization.
+func (c *Client) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	err := c.doAdminJSON(ctx, http.MethodGet, adminPath("users", id), nil, &user)
+	return user, err
+}
+
+// UpdateUserRole changes the organization role of a user. The admin role cannot be granted
+// through the API.
+func (c *Client) UpdateUserRole(ctx context.Context, id, role string) (User, error) {
+	var user User
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("users", id), map[string]string{"role": role}, &user)
+	return user, err
+}
+
+// RemoveUser removes a user from the organization.
+func (c *Client) RemoveUser(ctx context.Context, id string) error {
+	return c.doAdminJSON(ctx, http.MethodDelete, adminPath("users", id), nil, nil)
+}
+
+// Invites
+
+// Invite is an invitation for someone to join the organization.
+type Invite struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	InvitedAt time.Time `json:"invited_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateInvite invites the owner of email to join the organization with the given role.
+func (c *Client) CreateInvite(ctx context.Context, email, role string) (Invite, error) {
+	var invite Invite
+	err := c.doAdminJSON(ctx, http.MethodPost, "invites", map[string]string{"email": email, "role": role}, &invite)
+	return invite, err
+}
+
+// ListInvites returns a page of the invites of the organization.
+func (c *Client) ListInvites(ctx context.Context, opts ListOptions) (Page[Invite], error) {
+	return listAdmin[Invite](ctx, c, "invites", opts, nil)
+}
+
+// IterateInvites returns an iterator over all the invites of the organization.
+func (c *Client) IterateInvites(ctx context.Context, opts ListOptions) *PageIterator[Invite] {
+	return newPageIterator(ctx, opts, c.ListInvites)
+}
+
+// GetInvite returns an invite.
+func (c *Client) GetInvite(ctx context.Context, id string) (Invite, error) {
+	var invite Invite
+	err := c.doAdminJSON(ctx, http.MethodGet, adminPath("invites", id), nil, &invite)
+	return invite, err
+}
+
+// DeleteInvite deletes a pending invite.
+func (c *Client) DeleteInvite(ctx context.Context, id string) error {
+	return c.doAdminJSON(ctx, http.MethodDelete, adminPath("invites", id), nil, nil)
+}
+
+// Workspaces
+
+// Workspace groups API keys, members and usage within the organization.
+type Workspace struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	Name         string     `json:"name"`
+	DisplayColor string     `json:"display_color"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ArchivedAt   *time.Time `json:"archived_at"`
+}
+
+// WorkspaceFilter narrows down the workspaces returned by ListWorkspaces.
+type WorkspaceFilter struct {
+	// IncludeArchived includes the archived workspaces, which are left out by default.
+	IncludeArchived bool
+}
+
+// ListWorkspaces returns a page of the workspaces of the organization.
+func (c *Client) ListWorkspaces(ctx context.Context, opts ListOptions, filter WorkspaceFilter) (Page[Workspace], error) {
+	filters := url.Values{}
+	if filter.IncludeArchived {
+		filters.Set("include_archived", strconv.FormatBool(filter.IncludeArchived))
+	}
+	return listAdmin[Workspace](ctx, c, "workspaces", opts, filters)
+}
+
+// IterateWorkspaces returns an iterator over all the workspaces matching the filter.
+func (c *Client) IterateWorkspaces(ctx context.Context, opts ListOptions, filter WorkspaceFilter) *PageIterator[Workspace] {
+	return newPageIterator(ctx, opts, func(ctx context.Context, opts ListOptions) (Page[Workspace], error) {
+		return c.ListWorkspaces(ctx, opts, filter)
+	})
+}
+
+// GetWorkspace returns a workspace.
+func (c *Client) GetWorkspace(ctx context.Context, id string) (Workspace, error) {
+	var workspace Workspace
+	err := c.doAdminJSON(ctx, http.MethodGet, adminPath("workspaces", id), nil, &workspace)
+	return workspace, err
+}
+
+// CreateWorkspace creates a workspace.
+func (c *Client) CreateWorkspace(ctx context.Context, name string) (Workspace, error) {
+	var workspace Workspace
+	err := c.doAdminJSON(ctx, http.MethodPost, "workspaces", map[string]string{"name": name}, &workspace)
+	return workspace, err
+}
+
+// RenameWorkspace changes the name of a workspace.
+func (c *Client) RenameWorkspace(ctx context.Context, id, name string) (Workspace, error) {
+	var workspace Workspace
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("workspaces", id), map[string]string{"name": name}, &workspace)
+	return workspace, err
+}
+
+// ArchiveWorkspace archives a workspace. Its API keys stop working and it cannot be restored.
+func (c *Client) ArchiveWorkspace(ctx context.Context, id string) (Workspace, error) {
+	var workspace Workspace
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("workspaces", id, "archive"), nil, &workspace)
+	return workspace, err
+}
+
+// Workspace members
+
+// WorkspaceMember is a user of the organization with access to a workspace.
+type WorkspaceMember struct {
+	Type          string `json:"type"`
+	UserID        string `json:"user_id"`
+	WorkspaceID   string `json:"workspace_id"`
+	WorkspaceRole string `json:"workspace_role"`
+}
+
+// ListWorkspaceMembers returns a page of the members of a workspace.
+func (c *Client) ListWorkspaceMembers(ctx context.Context, workspaceID string, opts ListOptions) (Page[WorkspaceMember], error) {
+	return listAdmin[WorkspaceMember](ctx, c, adminPath("workspaces", workspaceID, "members"), opts, nil)
+}
+
+// IterateWorkspaceMembers returns an iterator over all the members of a workspace.
+func (c *Client) IterateWorkspaceMembers(ctx context.Context, workspaceID string, opts ListOptions) *PageIterator[WorkspaceMember] {
+	return newPageIterator(ctx, opts, func(ctx context.Context, opts ListOptions) (Page[WorkspaceMember], error) {
+		return c.ListWorkspaceMembers(ctx, workspaceID, opts)
+	})
+}
+
+// GetWorkspaceMember returns the membership of a user in a workspace.
+func (c *Client) GetWorkspaceMember(ctx context.Context, workspaceID, userID string) (WorkspaceMember, error) {
+	var member WorkspaceMember
+	err := c.doAdminJSON(ctx, http.MethodGet, adminPath("workspaces", workspaceID, "members", userID), nil, &member)
+	return member, err
+}
+
+// AddWorkspaceMember gives a user of the organization access to a workspace with the given
+// role.
+func (c *Client) AddWorkspaceMember(ctx context.Context, workspaceID, userID, role string) (WorkspaceMember, error) {
+	var member WorkspaceMember
+	payload := map[string]string{"user_id": userID, "workspace_role": role}
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("workspaces", workspaceID, "members"), payload, &member)
+	return member, err
+}
+
+// UpdateWorkspaceMemberRole changes the role of a member of a workspace.
+func (c *Client) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID, userID, role string) (WorkspaceMember, error) {
+	var member WorkspaceMember
+	payload := map[string]string{"workspace_role": role}
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("workspaces", workspaceID, "members", userID), payload, &member)
+	return member, err
+}
+
+// RemoveWorkspaceMember removes a user from a workspace.
+func (c *Client) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID string) error {
+	return c.doAdminJSON(ctx, http.MethodDelete, adminPath("workspaces", workspaceID, "members", userID), nil, nil)
+}
+
+// API keys
+
+// APIKey describes an API key of the organization. The secret itself is never returned.
+type APIKey struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	WorkspaceID *string   `json:"workspace_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"created_by"`
+	// PartialKeyHint is the redacted key, e.g. "sk-ant-api03-R2D...igAA".
+	PartialKeyHint string `json:"partial_key_hint"`
+}
+
+// APIKeyFilter narrows down the API keys returned by ListAPIKeys. Empty fields are ignored.
+type APIKeyFilter struct {
+	WorkspaceID     string
+	Status          string
+	CreatedByUserID string
+}
+
+// APIKeyUpdate holds the changes made by UpdateAPIKey. Empty fields are left unchanged.
+type APIKeyUpdate struct {
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// ListAPIKeys returns a page of the API keys of the organization.
+func (c *Client) ListAPIKeys(ctx context.Context, opts ListOptions, filter APIKeyFilter) (Page[APIKey], error) {
+	filters := url.Values{}
+	if filter.WorkspaceID != "" {
+		filters.Set("workspace_id", filter.WorkspaceID)
+	}
+	if filter.Status != "" {
+		filters.Set("status", filter.Status)
+	}
+	if filter.CreatedByUserID != "" {
+		filters.Set("created_by_user_id", filter.CreatedByUserID)
+	}
+	return listAdmin[APIKey](ctx, c, "api_keys", opts, filters)
+}
+
+// IterateAPIKeys returns an iterator over all the API keys matching the filter.
+func (c *Client) IterateAPIKeys(ctx context.Context, opts ListOptions, filter APIKeyFilter) *PageIterator[APIKey] {
+	return newPageIterator(ctx, opts, func(ctx context.Context, opts ListOptions) (Page[APIKey], error) {
+		return c.ListAPIKeys(ctx, opts, filter)
+	})
+}
+
+// GetAPIKey returns an API key.
+func (c *Client) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	var key APIKey
+	err := c.doAdminJSON(ctx, http.MethodGet, adminPath("api_keys", id), nil, &key)
+	return key, err
+}
+
+// UpdateAPIKey renames an API key or changes its status.
+func (c *Client) UpdateAPIKey(ctx context.Context, id string, update APIKeyUpdate) (APIKey, error) {
+	var key APIKey
+	err := c.doAdminJSON(ctx, http.MethodPost, adminPath("api_keys", id), update, &key)
+	return key, err
+}
+
+// DisableAPIKey makes an API key inactive, so that requests using it are rejected. It can be
+// enabled again by setting its status back to active with UpdateAPIKey.
+func (c *Client) DisableAPIKey(ctx context.Context, id string) (APIKey, error) {
+	return c.UpdateAPIKey(ctx, id, APIKeyUpdate{Status: APIKeyStatusInactive})
+}
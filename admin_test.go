@@ -0,0 +1,252 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRequest is a request received by adminServer.
+type adminRequest struct {
+	method string
+	path   string
+	query  string
+	body   string
+}
+
+// adminServer answers Admin API requests with the response registered for their method and
+// path, and records them.
+func adminServer(t *testing.T, responses map[string]string, requests *[]adminRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, adminRequest{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery, body: string(body)})
+
+		if r.Header.Get("x-api-key") != "sk-ant-admin-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+			return
+		}
+
+		response, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"type": "error", "error": {"type": "permission_error", "message": "not allowed"}}`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+}
+
+func newAdminTestClient(t *testing.T, baseURL string) *Client {
+	client, err := NewClient(WithApiKey("fake-key"), WithAdminApiKey("sk-ant-admin-key"))
+	require.NoError(t, err)
+	client.baseURL = baseURL + "/"
+	return client
+}
+
+func TestClient_AdminUsersAndInvites(t *testing.T) {
+	var requests []adminRequest
+	ts := adminServer(t, map[string]string{
+		"GET /organizations/users":           `{"data": [{"id": "user_1", "type": "user", "email": "ada@example.com", "role": "developer", "added_at": "2025-01-01T00:00:00Z"}], "has_more": false, "first_id": "user_1", "last_id": "user_1"}`,
+		"POST /organizations/users/user_1":   `{"id": "user_1", "type": "user", "email": "ada@example.com", "role": "billing"}`,
+		"DELETE /organizations/users/user_1": `{"id": "user_1", "type": "user_deleted"}`,
+		"POST /organizations/invites":        `{"id": "invite_1", "type": "invite", "email": "bob@example.com", "role": "user", "status": "pending", "invited_at": "2025-01-01T00:00:00Z", "expires_at": "2025-01-22T00:00:00Z"}`,
+		"GET /organizations/invites":         `{"data": [{"id": "invite_1", "status": "pending"}], "has_more": false}`,
+	}, &requests)
+	defer ts.Close()
+	client := newAdminTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	users, err := client.ListUsers(ctx, ListOptions{Limit: 10}, "ada@example.com")
+	require.NoError(t, err)
+	require.Len(t, users.Data, 1)
+	assert.Equal(t, UserRoleDeveloper, users.Data[0].Role)
+
+	user, err := client.UpdateUserRole(ctx, "user_1", UserRoleBilling)
+	require.NoError(t, err)
+	assert.Equal(t, UserRoleBilling, user.Role)
+
+	require.NoError(t, client.RemoveUser(ctx, "user_1"))
+
+	invite, err := client.CreateInvite(ctx, "bob@example.com", UserRoleUser)
+	require.NoError(t, err)
+	assert.Equal(t, InviteStatusPending, invite.Status)
+	assert.Equal(t, 22, invite.ExpiresAt.Day())
+
+	var invites []string
+	it := client.IterateInvites(ctx, ListOptions{})
+	for it.Next() {
+		invites = append(invites, it.Current().ID)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"invite_1"}, invites)
+
+	assert.Equal(t, []adminRequest{
+		{method: "GET", path: "/organizations/users", query: "email=ada%40example.com&limit=10"},
+		{method: "POST", path: "/organizations/users/user_1", body: `{"role":"billing"}`},
+		{method: "DELETE", path: "/organizations/users/user_1"},
+		{method: "POST", path: "/organizations/invites", body: `{"email":"bob@example.com","role":"user"}`},
+		{method: "GET", path: "/organizations/invites"},
+	}, requests)
+}
+
+func TestClient_AdminWorkspaces(t *testing.T) {
+	var requests []adminRequest
+	ts := adminServer(t, map[string]string{
+		"GET /organizations/workspaces":                            `{"data": [{"id": "wrkspc_1", "name": "Research", "created_at": "2025-01-01T00:00:00Z", "archived_at": null}], "has_more": false}`,
+		"POST /organizations/workspaces":                           `{"id": "wrkspc_2", "name": "Support"}`,
+		"POST /organizations/workspaces/wrkspc_2/archive":          `{"id": "wrkspc_2", "name": "Support", "archived_at": "2025-02-01T00:00:00Z"}`,
+		"POST /organizations/workspaces/wrkspc_1/members":          `{"type": "workspace_member", "user_id": "user_1", "workspace_id": "wrkspc_1", "workspace_role": "workspace_developer"}`,
+		"POST /organizations/workspaces/wrkspc_1/members/user_1":   `{"type": "workspace_member", "user_id": "user_1", "workspace_id": "wrkspc_1", "workspace_role": "workspace_admin"}`,
+		"DELETE /organizations/workspaces/wrkspc_1/members/user_1": `{"type": "workspace_member_deleted"}`,
+		"GET /organizations/workspaces/wrkspc_1/members":           `{"data": [{"user_id": "user_1", "workspace_role": "workspace_admin"}], "has_more": false}`,
+	}, &requests)
+	defer ts.Close()
+	client := newAdminTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	workspaces, err := client.ListWorkspaces(ctx, ListOptions{}, WorkspaceFilter{IncludeArchived: true})
+	require.NoError(t, err)
+	require.Len(t, workspaces.Data, 1)
+	assert.Nil(t, workspaces.Data[0].ArchivedAt)
+
+	workspace, err := client.CreateWorkspace(ctx, "Support")
+	require.NoError(t, err)
+	workspace, err = client.ArchiveWorkspace(ctx, workspace.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, workspace.ArchivedAt)
+
+	member, err := client.AddWorkspaceMember(ctx, "wrkspc_1", "user_1", WorkspaceRoleDeveloper)
+	require.NoError(t, err)
+	assert.Equal(t, WorkspaceRoleDeveloper, member.WorkspaceRole)
+	member, err = client.UpdateWorkspaceMemberRole(ctx, "wrkspc_1", "user_1", WorkspaceRoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, WorkspaceRoleAdmin, member.WorkspaceRole)
+	require.NoError(t, client.RemoveWorkspaceMember(ctx, "wrkspc_1", "user_1"))
+
+	it := client.IterateWorkspaceMembers(ctx, "wrkspc_1", ListOptions{})
+	require.True(t, it.Next())
+	assert.Equal(t, "user_1", it.Current().UserID)
+	assert.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	assert.Equal(t, []adminRequest{
+		{method: "GET", path: "/organizations/workspaces", query: "include_archived=true"},
+		{method: "POST", path: "/organizations/workspaces", body: `{"name":"Support"}`},
+		{method: "POST", path: "/organizations/workspaces/wrkspc_2/archive"},
+		{method: "POST", path: "/organizations/workspaces/wrkspc_1/members", body: `{"user_id":"user_1","workspace_role":"workspace_developer"}`},
+		{method: "POST", path: "/organizations/workspaces/wrkspc_1/members/user_1", body: `{"workspace_role":"workspace_admin"}`},
+		{method: "DELETE", path: "/organizations/workspaces/wrkspc_1/members/user_1"},
+		{method: "GET", path: "/organizations/workspaces/wrkspc_1/members"},
+	}, requests)
+}
+
+func TestClient_AdminAPIKeys(t *testing.T) {
+	var requests []adminRequest
+	ts := adminServer(t, map[string]string{
+		"GET /organizations/api_keys": `{"data": [
+			{"id": "apikey_1", "type": "api_key", "name": "ci", "status": "active", "workspace_id": "wrkspc_1", "created_by": {"id": "user_1", "type": "user"}, "partial_key_hint": "sk-ant-api03-abc...xyz"}
+		], "has_more": false}`,
+		"POST /organizations/api_keys/apikey_1": `{"id": "apikey_1", "name": "ci", "status": "inactive", "workspace_id": "wrkspc_1"}`,
+	}, &requests)
+	defer ts.Close()
+	client := newAdminTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	it := client.IterateAPIKeys(ctx, ListOptions{}, APIKeyFilter{WorkspaceID: "wrkspc_1", Status: APIKeyStatusActive})
+	require.True(t, it.Next())
+	key := it.Current()
+	assert.Equal(t, "user_1", key.CreatedBy.ID)
+	assert.Equal(t, "wrkspc_1", *key.WorkspaceID)
+	assert.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	key, err := client.DisableAPIKey(ctx, key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyStatusInactive, key.Status)
+
+	_, err = client.UpdateAPIKey(ctx, "apikey_1", APIKeyUpdate{Name: "ci-rotated"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []adminRequest{
+		{method: "GET", path: "/organizations/api_keys", query: "status=active&workspace_id=wrkspc_1"},
+		{method: "POST", path: "/organizations/api_keys/apikey_1", body: `{"status":"inactive"}`},
+		{method: "POST", path: "/organizations/api_keys/apikey_1", body: `{"name":"ci-rotated"}`},
+	}, requests)
+}
+
+func TestClient_AdminPermissionErrors(t *testing.T) {
+	var requests []adminRequest
+	ts := adminServer(t, map[string]string{}, &requests)
+	defer ts.Close()
+	ctx := context.Background()
+
+	client := newAdminTestClient(t, ts.URL)
+	_, err := client.GetAPIKey(ctx, "apikey_1")
+	assert.EqualError(t, err, "permission_error: not allowed")
+
+	var permissionErr *PermissionError
+	require.True(t, errors.As(err, &permissionErr))
+	assert.False(t, permissionErr.Unauthenticated())
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+
+	client.adminKey = "sk-ant-admin-revoked"
+	_, err = client.GetWorkspace(ctx, "wrkspc_1")
+	require.True(t, errors.As(err, &permissionErr))
+	assert.True(t, permissionErr.Unauthenticated())
+
+	client.adminKey = ""
+	_, err = client.ListInvites(ctx, ListOptions{})
+	assert.Equal(t, ErrNoAdminKey, err)
+	assert.Len(t, requests, 2)
+
+	// requests of the regular API keep returning an *APIError
+	client.baseURL = ts.URL + "/"
+	_, err = client.MessageRequest(ctx, MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("hi")})
+	require.True(t, errors.As(err, &apiErr))
+	assert.False(t, errors.As(err, &permissionErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestNewClient_AdminKey(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	os.Unsetenv("ANTHROPIC_API_KEY")
+	t.Setenv("ANTHROPIC_ADMIN_KEY", "sk-ant-admin-env")
+
+	// the admin key is not read from the environment
+	_, err := NewClient()
+	assert.EqualError(t, err, "ANTHROPIC_API_KEY not found in environment and not provided as option")
+
+	client, err := NewClient(WithApiKey("sk-ant-api-key"))
+	require.NoError(t, err)
+	assert.Empty(t, client.adminKey)
+
+	// an admin key is enough to create a client
+	client, err = NewClient(WithAdminApiKey("sk-ant-admin-option"))
+	require.NoError(t, err)
+	assert.Equal(t, "sk-ant-admin-option", client.adminKey)
+
+	// admin requests send the admin key instead of the API key
+	var key string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("x-api-key")
+		json.NewEncoder(w).Encode(Workspace{ID: "wrkspc_1"})
+	}))
+	defer ts.Close()
+	client.apiKey = "sk-ant-api-key"
+	client.baseURL = ts.URL + "/"
+
+	_, err = client.GetWorkspace(context.Background(), "wrkspc_1")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-ant-admin-option", key)
+}
@@ -1,10 +1,21 @@
 package anthrogo
 
-// AnthropicModel is the model to be used for the completion request.
-// TODO: model may not include completions or messages API support (add flags)
+// AnthropicModel is the model to be used for the completion request. The APIs and features
+// each model supports are recorded in DefaultModelRegistry.
 type AnthropicModel string
 
 const (
+	ModelClaudeOpus4Dot5   AnthropicModel = "claude-opus-4-5-20251101"
+	ModelClaudeSonnet4Dot5 AnthropicModel = "claude-sonnet-4-5-20250929"
+	ModelClaudeHaiku4Dot5  AnthropicModel = "claude-haiku-4-5-20251001"
+
+	ModelClaudeOpus4Dot1 AnthropicModel = "claude-opus-4-1-20250805"
+	ModelClaudeOpus4     AnthropicModel = "claude-opus-4-20250514"
+	ModelClaudeSonnet4   AnthropicModel = "claude-sonnet-4-20250514"
+
+	ModelClaude3Dot7Sonnet AnthropicModel = "claude-3-7-sonnet-20250219"
+	ModelClaude3Dot5Haiku  AnthropicModel = "claude-3-5-haiku-20241022"
+
 	ModelClaude3Dot5Sonnet AnthropicModel = "claude-3-5-sonnet-20240620"
 
 	ModelClaude3Opus   AnthropicModel = "claude-3-opus-20240229"
@@ -0,0 +1,555 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchPollInterval    = 30 * time.Second
+	DefaultBatchMaxPollInterval = 5 * time.Minute
+)
+
+// Statuses of a batch job.
+const (
+	// BatchJobSubmitting is the status of a job whose batches are being created.
+	BatchJobSubmitting = "submitting"
+	// BatchJobRunning is the status of a job whose batches are processing.
+	BatchJobRunning = "running"
+	// BatchJobCompleted is the status of a job whose results were all delivered.
+	BatchJobCompleted = "completed"
+	// BatchJobFailed is the status of a job that could not be fully submitted. The batches
+	// created before the failure are still waited for and their results delivered.
+	BatchJobFailed = "failed"
+)
+
+var (
+	// ErrBatchJobNotFound is returned by a BatchJobStore for unknown jobs.
+	ErrBatchJobNotFound = errors.New("batch job not found")
+	// ErrBatchJobExists is returned by a BatchJobStore when creating a job that exists.
+	ErrBatchJobExists = errors.New("batch job already exists")
+)
+
+// BatchJob is the state of a job saved by a BatchManager. A job is made of one or more
+// batches, depending on the number and size of its requests.
+type BatchJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Error describes why the job failed.
+	Error    string   `json:"error,omitempty"`
+	BatchIDs []string `json:"batch_ids"`
+	// Delivered lists the batches whose results were written to the sink.
+	Delivered []string `json:"delivered,omitempty"`
+	// Keys maps the custom_id of each request to the key given by the caller.
+	Keys      map[string]string `json:"keys"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// BatchJobRequest is a request of a job. Key identifies the request for the caller and is
+// passed back with its result; unlike a custom_id it may be any string.
+type BatchJobRequest struct {
+	Key    string
+	Params MessagePayload
+}
+
+// BatchJobStore persists batch jobs.
+type BatchJobStore interface {
+	// Create saves a new job. It returns ErrBatchJobExists if a job with the same ID exists,
+	// checking and saving as one step so that concurrent calls cannot both succeed.
+	Create(ctx context.Context, job BatchJob) error
+	Save(ctx context.Context, job BatchJob) error
+	// Load returns ErrBatchJobNotFound if the job does not exist.
+	Load(ctx context.Context, id string) (BatchJob, error)
+	List(ctx context.Context) ([]BatchJob, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// BatchResultSink receives the results of the requests of a job.
+type BatchResultSink interface {
+	WriteBatchResult(ctx context.Context, job BatchJob, key string, result BatchResult) error
+}
+
+// BatchResultSinkFunc adapts a function to a BatchResultSink.
+type BatchResultSinkFunc func(ctx context.Context, job BatchJob, key string, result BatchResult) error
+
+// WriteBatchResult calls f.
+func (f BatchResultSinkFunc) WriteBatchResult(ctx context.Context, job BatchJob, key string, result BatchResult) error {
+	return f(ctx, job, key, result)
+}
+
+// BatchManager submits jobs as message batches and tracks them until their results are
+// delivered. Jobs are saved to a BatchJobStore so that a manager created after a restart
+// can pick them up with Resume.
+//
+// Results are delivered at least once: if the process stops while the results of a batch
+// are being written, they are written again when the job is resumed.
+type BatchManager struct {
+	client *Client
+	store  BatchJobStore
+
+	// PollInterval is the delay before a batch is polled again. It doubles after each poll
+	// up to MaxPollInterval. Zero or negative values use the defaults.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// Sink receives the result of each request once its batch has ended.
+	Sink BatchResultSink
+	// OnComplete is called once the results of all the batches of a job were delivered.
+	OnComplete func(ctx context.Context, job BatchJob)
+
+	// mu serializes the updates of the jobs in the store and guards submitting.
+	mu sync.Mutex
+	// submitting holds the IDs of the jobs this manager is submitting.
+	submitting map[string]bool
+}
+
+// NewBatchManager returns a manager saving its jobs to store.
+func NewBatchManager(client *Client, store BatchJobStore) *BatchManager {
+	return &BatchManager{
+		client:          client,
+		store:           store,
+		PollInterval:    DefaultBatchPollInterval,
+		MaxPollInterval: DefaultBatchMaxPollInterval,
+		submitting:      map[string]bool{},
+	}
+}
+
+// Submit creates the batches of a new job. The job is created in the store before the
+// batches are, so a job ID can only be submitted once and Submit fails with
+// ErrBatchJobExists otherwise; a failed job has to be deleted from the store before it is
+// submitted again.
+//
+// The ID of each batch is saved as soon as the batch is created, so that the batches
+// created before a failure or a crash are not lost: Wait and Resume deliver their results.
+func (m *BatchManager) Submit(ctx context.Context, jobID string, requests []BatchJobRequest) (BatchJob, error) {
+	now := time.Now()
+	job := BatchJob{
+		ID:        jobID,
+		Status:    BatchJobSubmitting,
+		Keys:      make(map[string]string, len(requests)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	batchRequests := make([]BatchRequest, len(requests))
+	for i, request := range requests {
+		customID := "r" + strconv.Itoa(i)
+		job.Keys[customID] = request.Key
+		batchRequests[i] = BatchRequest{CustomID: customID, Params: request.Params}
+	}
+
+	if !m.startSubmitting(jobID) {
+		return BatchJob{}, fmt.Errorf("%w: %q", ErrBatchJobExists, jobID)
+	}
+	defer m.stopSubmitting(jobID)
+
+	if err := m.create(ctx, &job); errors.Is(err, ErrBatchJobExists) {
+		return BatchJob{}, fmt.Errorf("%w: %q", ErrBatchJobExists, jobID)
+	} else if err != nil {
+		return job, err
+	}
+
+	err := m.client.createMessageBatches(ctx, batchRequests, func(batch MessageBatch) error {
+		job.BatchIDs = append(job.BatchIDs, batch.ID)
+		return m.save(ctx, &job)
+	})
+
+	job.Status = BatchJobRunning
+	if err != nil {
+		job.Status, job.Error = BatchJobFailed, err.Error()
+	}
+	if saveErr := m.save(ctx, &job); saveErr != nil {
+		return job, errors.Join(err, saveErr)
+	}
+
+	return job, err
+}
+
+// Wait polls the batches of a job until they have ended, delivers their results to Sink and
+// calls OnComplete. It returns the completed job.
+//
+// The batches of a failed job are waited for and delivered too, after which an error is
+// returned as the job is not complete. A job left submitting by a crash is marked as failed,
+// since its remaining requests are not known to the store.
+func (m *BatchManager) Wait(ctx context.Context, jobID string) (BatchJob, error) {
+	job, err := m.store.Load(ctx, jobID)
+	if err != nil {
+		return job, err
+	}
+
+	switch job.Status {
+	case BatchJobCompleted:
+		return job, nil
+	case BatchJobSubmitting:
+		if m.isSubmitting(jobID) {
+			return job, fmt.Errorf("batch job %q is %s", jobID, job.Status)
+		}
+		job.Status, job.Error = BatchJobFailed, "submission was interrupted"
+		if err := m.save(ctx, &job); err != nil {
+			return job, err
+		}
+	case BatchJobRunning, BatchJobFailed:
+	default:
+		return job, fmt.Errorf("batch job %q is %s", jobID, job.Status)
+	}
+
+	for _, batchID := range job.BatchIDs {
+		if slices.Contains(job.Delivered, batchID) {
+			continue
+		}
+
+		if err := m.waitForBatch(ctx, batchID); err != nil {
+			return job, err
+		}
+		if err := m.deliver(ctx, job, batchID); err != nil {
+			return job, err
+		}
+
+		job.Delivered = append(job.Delivered, batchID)
+		if err := m.save(ctx, &job); err != nil {
+			return job, err
+		}
+	}
+
+	if job.Status == BatchJobFailed {
+		return job, fmt.Errorf("batch job %q is %s", jobID, job.Status)
+	}
+
+	job.Status = BatchJobCompleted
+	if err := m.save(ctx, &job); err != nil {
+		return job, err
+	}
+
+	if m.OnComplete != nil {
+		m.OnComplete(ctx, job)
+	}
+
+	return job, nil
+}
+
+// Resume waits for all the running jobs of the store, typically after a restart, as well as
+// the jobs left submitting by a crash and the failed jobs with undelivered batches. The jobs
+// are waited for concurrently and their errors are joined.
+func (m *BatchManager) Resume(ctx context.Context) error {
+	jobs, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(jobs))
+	for i, job := range jobs {
+		if !m.resumable(job) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, jobID string) {
+			defer wg.Done()
+			if _, err := m.Wait(ctx, jobID); err != nil {
+				errs[i] = fmt.Errorf("batch job %q: %w", jobID, err)
+			}
+		}(i, job.ID)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// resumable reports whether Resume should wait for a job.
+func (m *BatchManager) resumable(job BatchJob) bool {
+	switch job.Status {
+	case BatchJobRunning:
+		return true
+	case BatchJobSubmitting:
+		return !m.isSubmitting(job.ID)
+	case BatchJobFailed:
+		for _, batchID := range job.BatchIDs {
+			if !slices.Contains(job.Delivered, batchID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// waitForBatch polls a batch with backoff until it has ended.
+func (m *BatchManager) waitForBatch(ctx context.Context, batchID string) error {
+	interval, maxInterval := m.PollInterval, m.MaxPollInterval
+	if interval <= 0 {
+		interval = DefaultBatchPollInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = DefaultBatchMaxPollInterval
+	}
+
+	for {
+		batch, err := m.client.RetrieveMessageBatch(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		if batch.ProcessingStatus == BatchStatusEnded {
+			return nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		interval = min(interval*2, maxInterval)
+	}
+}
+
+// deliver writes the results of an ended batch to the sink.
+func (m *BatchManager) deliver(ctx context.Context, job BatchJob, batchID string) error {
+	if m.Sink == nil {
+		return nil
+	}
+
+	results, err := m.client.MessageBatchResults(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for {
+		result, err := results.Decode()
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			return nil
+		}
+
+		key, ok := job.Keys[result.CustomID]
+		if !ok {
+			return fmt.Errorf("batch %s returned unknown custom_id %q", batchID, result.CustomID)
+		}
+		if err := m.Sink.WriteBatchResult(ctx, job, key, *result); err != nil {
+			return err
+		}
+	}
+}
+
+// create adds the job to the store with an updated timestamp.
+func (m *BatchManager) create(ctx context.Context, job *BatchJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.UpdatedAt = time.Now()
+	return m.store.Create(ctx, *job)
+}
+
+// save stores the job with an updated timestamp.
+func (m *BatchManager) save(ctx context.Context, job *BatchJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.UpdatedAt = time.Now()
+	return m.store.Save(ctx, *job)
+}
+
+// startSubmitting marks a job as being submitted by this manager. It returns false if it
+// already is.
+func (m *BatchManager) startSubmitting(jobID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.submitting[jobID] {
+		return false
+	}
+	m.submitting[jobID] = true
+	return true
+}
+
+func (m *BatchManager) stopSubmitting(jobID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.submitting, jobID)
+}
+
+func (m *BatchManager) isSubmitting(jobID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.submitting[jobID]
+}
+
+// FileBatchJobStore saves each job as a JSON file in a directory.
+type FileBatchJobStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileBatchJobStore returns a store saving jobs in dir, which is created if needed.
+func NewFileBatchJobStore(dir string) (*FileBatchJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileBatchJobStore{dir: dir}, nil
+}
+
+// Create writes a new job to a file opened with O_EXCL, so that only one of concurrent calls
+// for the same ID, even from different processes, can create it.
+func (s *FileBatchJobStore) Create(ctx context.Context, job BatchJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path(job.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return ErrBatchJobExists
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.path(job.ID))
+	}
+	return err
+}
+
+// Save writes the job to a temporary file that replaces the previous state, so that a crash
+// never leaves a partially written job behind.
+func (s *FileBatchJobStore) Save(ctx context.Context, job BatchJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".job-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(job.ID))
+}
+
+// Load reads a job.
+func (s *FileBatchJobStore) Load(ctx context.Context, id string) (BatchJob, error) {
+	var job BatchJob
+
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return job, ErrBatchJobNotFound
+	}
+	if err != nil {
+		return job, err
+	}
+
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
+
+// List returns all the jobs ordered by creation time.
+func (s *FileBatchJobStore) List(ctx context.Context) ([]BatchJob, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]BatchJob, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var job BatchJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// Delete removes a job.
+func (s *FileBatchJobStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrBatchJobNotFound
+	}
+	return err
+}
+
+// path returns the file of a job. The ID is quoted so that it cannot escape the directory.
+func (s *FileBatchJobStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+// JSONLBatchResultSink writes each result as a line of JSON holding the key of the request
+// and its result.
+type JSONLBatchResultSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewJSONLBatchResultSink returns a sink writing to w.
+func NewJSONLBatchResultSink(w io.Writer) *JSONLBatchResultSink {
+	return &JSONLBatchResultSink{w: w}
+}
+
+// WriteBatchResult writes a line for the result.
+func (s *JSONLBatchResultSink) WriteBatchResult(ctx context.Context, job BatchJob, key string, result BatchResult) error {
+	data, err := json.Marshal(struct {
+		JobID string `json:"job_id"`
+		Key   string `json:"key"`
+		BatchResult
+	}{JobID: job.ID, Key: key, BatchResult: result})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,358 @@
+package anthrogo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBatchServer serves the batch endpoints. Batches end after the given number of polls
+// and each request is answered with the text of its last message in upper case.
+type fakeBatchServer struct {
+	mu       sync.Mutex
+	endAfter int
+	batches  map[string][]BatchRequest
+	polls    map[string]int
+}
+
+func newFakeBatchServer(t *testing.T, endAfter int) (*fakeBatchServer, *httptest.Server) {
+	fake := &fakeBatchServer{endAfter: endAfter, batches: map[string][]BatchRequest{}, polls: map[string]int{}}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		path := strings.TrimPrefix(r.URL.Path, "/messages/batches")
+
+		switch {
+		case r.Method == http.MethodPost && path == "":
+			var payload createMessageBatchPayload
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+			id := fmt.Sprintf("msgbatch_%d", len(fake.batches)+1)
+			fake.batches[id] = payload.Requests
+			fmt.Fprintf(w, `{"id": %q, "processing_status": "in_progress"}`, id)
+		case strings.HasSuffix(path, "/results"):
+			id := strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/results")
+			for _, request := range fake.batches[id] {
+				text := *request.Params.Messages[0].Content[0].Text
+				result := BatchResult{CustomID: request.CustomID, Result: BatchResultOutput{
+					Type:    BatchResultSucceeded,
+					Message: &MessageResponse{Content: []ContentBlock{{Type: "text", Text: strings.ToUpper(text)}}},
+				}}
+				require.NoError(t, json.NewEncoder(w).Encode(result))
+			}
+		default:
+			id := strings.TrimPrefix(path, "/")
+			fake.polls[id]++
+			status := BatchStatusInProgress
+			if fake.polls[id] > fake.endAfter {
+				status = BatchStatusEnded
+			}
+			fmt.Fprintf(w, `{"id": %q, "processing_status": %q}`, id, status)
+		}
+	}))
+
+	return fake, ts
+}
+
+func TestBatchManager_ResumeAfterRestart(t *testing.T) {
+	fake, ts := newFakeBatchServer(t, 2)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewFileBatchJobStore(dir)
+	require.NoError(t, err)
+	manager := NewBatchManager(newTestClient(t, ts.URL), store)
+
+	var requests []BatchJobRequest
+	for _, text := range []string{"alpha", "beta", "gamma"} {
+		requests = append(requests, BatchJobRequest{
+			Key:    "docs/" + text + ".txt",
+			Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation(text)},
+		})
+	}
+
+	job, err := manager.Submit(ctx, "nightly", requests)
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobRunning, job.Status)
+	assert.Equal(t, []string{"msgbatch_1"}, job.BatchIDs)
+
+	_, err = manager.Submit(ctx, "nightly", requests)
+	assert.ErrorIs(t, err, ErrBatchJobExists)
+	assert.EqualError(t, err, `batch job already exists: "nightly"`)
+
+	// the process restarts: a new manager only has the store to go on
+	store, err = NewFileBatchJobStore(dir)
+	require.NoError(t, err)
+	manager = NewBatchManager(newTestClient(t, ts.URL), store)
+	manager.PollInterval = time.Millisecond
+	manager.MaxPollInterval = 2 * time.Millisecond
+
+	results := map[string]string{}
+	manager.Sink = BatchResultSinkFunc(func(ctx context.Context, job BatchJob, key string, result BatchResult) error {
+		results[key] = result.Result.Message.Content[0].Text
+		return nil
+	})
+	var completed []BatchJob
+	manager.OnComplete = func(ctx context.Context, job BatchJob) {
+		completed = append(completed, job)
+	}
+
+	require.NoError(t, manager.Resume(ctx))
+
+	assert.Equal(t, map[string]string{
+		"docs/alpha.txt": "ALPHA",
+		"docs/beta.txt":  "BETA",
+		"docs/gamma.txt": "GAMMA",
+	}, results)
+	assert.Equal(t, 3, fake.polls["msgbatch_1"])
+
+	require.Len(t, completed, 1)
+	assert.Equal(t, "nightly", completed[0].ID)
+
+	saved, err := store.Load(ctx, "nightly")
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobCompleted, saved.Status)
+	assert.Equal(t, []string{"msgbatch_1"}, saved.Delivered)
+	assert.Equal(t, "docs/beta.txt", saved.Keys["r1"])
+
+	// completed jobs are not resumed again
+	require.NoError(t, manager.Resume(ctx))
+	assert.Len(t, completed, 1)
+}
+
+func TestBatchManager_WaitCanceled(t *testing.T) {
+	_, ts := newFakeBatchServer(t, 1000)
+	defer ts.Close()
+
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+	manager := NewBatchManager(newTestClient(t, ts.URL), store)
+	manager.PollInterval = time.Millisecond
+
+	_, err = manager.Submit(context.Background(), "job", []BatchJobRequest{
+		{Key: "a", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("a")}},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = manager.Wait(ctx, "job")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	job, err := store.Load(context.Background(), "job")
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobRunning, job.Status)
+}
+
+func TestBatchManager_SubmitFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"type": "invalid_request_error", "message": "bad"}}`))
+	}))
+	defer ts.Close()
+
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+	manager := NewBatchManager(newTestClient(t, ts.URL), store)
+
+	_, err = manager.Submit(context.Background(), "job", []BatchJobRequest{
+		{Key: "a", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("a")}},
+	})
+	assert.EqualError(t, err, "invalid_request_error: bad")
+
+	job, err := store.Load(context.Background(), "job")
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobFailed, job.Status)
+	assert.Equal(t, "invalid_request_error: bad", job.Error)
+
+	_, err = manager.Wait(context.Background(), "job")
+	assert.EqualError(t, err, `batch job "job" is failed`)
+}
+
+// crashingStore fails to save a job once it is running, like a process stopping right
+// after its batches were created.
+type crashingStore struct {
+	BatchJobStore
+}
+
+func (s crashingStore) Save(ctx context.Context, job BatchJob) error {
+	if job.Status == BatchJobRunning {
+		return fmt.Errorf("crash")
+	}
+	return s.BatchJobStore.Save(ctx, job)
+}
+
+func TestBatchManager_ResumeInterrupted(t *testing.T) {
+	fake, ts := newFakeBatchServer(t, 0)
+	defer ts.Close()
+
+	ctx := context.Background()
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+	client := newTestClient(t, ts.URL)
+
+	// the batch IDs are saved before the job is marked as running
+	_, err = NewBatchManager(client, crashingStore{store}).Submit(ctx, "crashed", []BatchJobRequest{
+		{Key: "a", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("a")}},
+	})
+	assert.EqualError(t, err, "crash")
+
+	saved, err := store.Load(ctx, "crashed")
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobSubmitting, saved.Status)
+	assert.Equal(t, []string{"msgbatch_1"}, saved.BatchIDs)
+
+	// a job that failed after creating some of its batches
+	batch, err := client.CreateMessageBatch(ctx, []BatchRequest{
+		{CustomID: "r0", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("b")}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, BatchJob{
+		ID: "partial", Status: BatchJobFailed, Error: "invalid_request_error: bad",
+		BatchIDs: []string{batch.ID}, Keys: map[string]string{"r0": "b", "r1": "c"},
+	}))
+
+	manager := NewBatchManager(client, store)
+	manager.PollInterval = time.Millisecond
+	var mu sync.Mutex
+	results := map[string]string{}
+	manager.Sink = BatchResultSinkFunc(func(ctx context.Context, job BatchJob, key string, result BatchResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		results[key] = result.Result.Message.Content[0].Text
+		return nil
+	})
+	manager.OnComplete = func(ctx context.Context, job BatchJob) {
+		t.Errorf("job %s is not complete", job.ID)
+	}
+
+	err = manager.Resume(ctx)
+	assert.ErrorContains(t, err, `batch job "crashed": batch job "crashed" is failed`)
+	assert.ErrorContains(t, err, `batch job "partial": batch job "partial" is failed`)
+	assert.Equal(t, map[string]string{"a": "A", "b": "B"}, results)
+
+	saved, err = store.Load(ctx, "crashed")
+	require.NoError(t, err)
+	assert.Equal(t, BatchJobFailed, saved.Status)
+	assert.Equal(t, "submission was interrupted", saved.Error)
+	assert.Equal(t, []string{"msgbatch_1"}, saved.Delivered)
+
+	// delivered failed jobs are not resumed again
+	require.NoError(t, manager.Resume(ctx))
+	assert.Equal(t, 1, fake.polls["msgbatch_1"])
+	assert.Equal(t, 1, fake.polls["msgbatch_2"])
+}
+
+func TestBatchManager_ZeroPollInterval(t *testing.T) {
+	fake, ts := newFakeBatchServer(t, 1000)
+	defer ts.Close()
+
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+	manager := NewBatchManager(newTestClient(t, ts.URL), store)
+	manager.PollInterval, manager.MaxPollInterval = 0, 0
+
+	_, err = manager.Submit(context.Background(), "job", []BatchJobRequest{
+		{Key: "a", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("a")}},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the default interval is used rather than polling in a loop
+	_, err = manager.Wait(ctx, "job")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, fake.polls["msgbatch_1"])
+}
+
+func TestBatchManager_ConcurrentSubmit(t *testing.T) {
+	fake, ts := newFakeBatchServer(t, 0)
+	defer ts.Close()
+
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+	client := newTestClient(t, ts.URL)
+	requests := []BatchJobRequest{{Key: "a", Params: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("a")}}}
+
+	// managers of different processes share the store
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = NewBatchManager(client, store).Submit(context.Background(), "once", requests)
+		}(i)
+	}
+	wg.Wait()
+
+	submitted := 0
+	for _, err := range errs {
+		if err == nil {
+			submitted++
+		} else {
+			assert.ErrorIs(t, err, ErrBatchJobExists)
+		}
+	}
+	assert.Equal(t, 1, submitted)
+	assert.Len(t, fake.batches, 1)
+}
+
+func TestFileBatchJobStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileBatchJobStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = store.Load(ctx, "missing")
+	assert.ErrorIs(t, err, ErrBatchJobNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, "missing"), ErrBatchJobNotFound)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	second := BatchJob{ID: "../second", Status: BatchJobRunning, CreatedAt: now.Add(time.Minute)}
+	first := BatchJob{ID: "first", Status: BatchJobCompleted, BatchIDs: []string{"b"}, Keys: map[string]string{"r0": "k"}, CreatedAt: now}
+	require.NoError(t, store.Create(ctx, second))
+	require.NoError(t, store.Save(ctx, first))
+	assert.ErrorIs(t, store.Create(ctx, first), ErrBatchJobExists)
+	assert.ErrorIs(t, store.Create(ctx, BatchJob{ID: "../second"}), ErrBatchJobExists)
+
+	first.Status = BatchJobRunning
+	require.NoError(t, store.Save(ctx, first))
+
+	jobs, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []BatchJob{first, second}, jobs)
+
+	require.NoError(t, store.Delete(ctx, "../second"))
+	jobs, err = store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestJSONLBatchResultSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLBatchResultSink(&buf)
+
+	require.NoError(t, sink.WriteBatchResult(context.Background(), BatchJob{ID: "job"}, "k", BatchResult{
+		CustomID: "r0",
+		Result:   BatchResultOutput{Type: BatchResultExpired},
+	}))
+
+	assert.Equal(t, `{"job_id":"job","key":"k","custom_id":"r0","result":{"type":"expired"}}`+"\n", buf.String())
+}
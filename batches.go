@@ -0,0 +1,361 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	RequestTypeMessageBatches = "messages/batches"
+
+	// MaxBatchRequests is the largest number of requests in a batch.
+	MaxBatchRequests = 100_000
+	// MaxBatchBytes is the largest size of the body creating a batch.
+	MaxBatchBytes = 256 * 1024 * 1024
+)
+
+// Processing statuses of a batch.
+const (
+	BatchStatusInProgress = "in_progress"
+	BatchStatusCanceling  = "canceling"
+	BatchStatusEnded      = "ended"
+)
+
+// Result types of a batch request.
+const (
+	BatchResultSucceeded = "succeeded"
+	BatchResultErrored   = "errored"
+	BatchResultCanceled  = "canceled"
+	BatchResultExpired   = "expired"
+)
+
+// ErrBatchTooLarge is returned by CreateMessageBatch when the requests exceed the batch
+// limits. CreateMessageBatches splits them instead.
+var ErrBatchTooLarge = errors.New("batch exceeds the request count or size limit")
+
+var customIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// BatchRequest is a request of a batch. CustomID identifies its result and must be unique
+// within the batch.
+type BatchRequest struct {
+	CustomID string         `json:"custom_id"`
+	Params   MessagePayload `json:"params"`
+}
+
+// BatchRequestCounts counts the requests of a batch by status.
+type BatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// MessageBatch describes a batch of message requests.
+type MessageBatch struct {
+	ID                string             `json:"id"`
+	Type              string             `json:"type"`
+	ProcessingStatus  string             `json:"processing_status"`
+	RequestCounts     BatchRequestCounts `json:"request_counts"`
+	CreatedAt         time.Time          `json:"created_at"`
+	ExpiresAt         time.Time          `json:"expires_at"`
+	EndedAt           *time.Time         `json:"ended_at"`
+	ArchivedAt        *time.Time         `json:"archived_at"`
+	CancelInitiatedAt *time.Time         `json:"cancel_initiated_at"`
+	// ResultsURL is set once the batch has ended.
+	ResultsURL *string `json:"results_url"`
+}
+
+// BatchResult is the result of a request of a batch.
+type BatchResult struct {
+	CustomID string            `json:"custom_id"`
+	Result   BatchResultOutput `json:"result"`
+}
+
+// BatchResultOutput holds the response of a succeeded request or the error of an errored
+// one. Canceled and expired requests have neither.
+type BatchResultOutput struct {
+	Type    string           `json:"type"`
+	Message *MessageResponse `json:"message,omitempty"`
+	Error   *ErrorResponse   `json:"error,omitempty"`
+}
+
+// Err returns the error of an errored result, nil otherwise.
+func (r BatchResult) Err() error {
+	if r.Result.Type != BatchResultErrored || r.Result.Error == nil {
+		return nil
+	}
+	return &APIError{Type: r.Result.Error.Error.Type, Message: r.Result.Error.Error.Message}
+}
+
+type createMessageBatchPayload struct {
+	Requests []BatchRequest `json:"requests"`
+}
+
+// CreateMessageBatch creates a batch from the requests. The requests are validated like the
+// payload of MessageRequest and ErrBatchTooLarge is returned when they exceed
+// MaxBatchRequests or MaxBatchBytes.
+func (c *Client) CreateMessageBatch(ctx context.Context, requests []BatchRequest) (MessageBatch, error) {
+	var batch MessageBatch
+
+	requests, sizes, err := c.prepareBatchRequests(requests)
+	if err != nil {
+		return batch, err
+	}
+
+	chunks, err := splitBatchRequests(sizes, MaxBatchRequests, MaxBatchBytes)
+	if err != nil {
+		return batch, err
+	}
+	if len(chunks) > 1 {
+		return batch, ErrBatchTooLarge
+	}
+
+	err = c.doJSON(ctx, http.MethodPost, RequestTypeMessageBatches, createMessageBatchPayload{Requests: requests}, &batch, batchRequestOptions(requests)...)
+	return batch, err
+}
+
+// CreateMessageBatches creates as many batches as needed to stay within the batch limits.
+// On error the batches created so far are returned along with it.
+func (c *Client) CreateMessageBatches(ctx context.Context, requests []BatchRequest) ([]MessageBatch, error) {
+	var batches []MessageBatch
+	err := c.createMessageBatches(ctx, requests, func(batch MessageBatch) error {
+		batches = append(batches, batch)
+		return nil
+	})
+	return batches, err
+}
+
+// createMessageBatches creates the batches of CreateMessageBatches, calling created with each
+// batch as soon as it exists. An error returned by created stops the creation.
+func (c *Client) createMessageBatches(ctx context.Context, requests []BatchRequest, created func(MessageBatch) error) error {
+	requests, sizes, err := c.prepareBatchRequests(requests)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := splitBatchRequests(sizes, MaxBatchRequests, MaxBatchBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		var batch MessageBatch
+		payload := createMessageBatchPayload{Requests: requests[chunk[0]:chunk[1]]}
+		if err := c.doJSON(ctx, http.MethodPost, RequestTypeMessageBatches, payload, &batch, batchRequestOptions(payload.Requests)...); err != nil {
+			return err
+		}
+		if err := created(batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RetrieveMessageBatch returns the current state of a batch.
+func (c *Client) RetrieveMessageBatch(ctx context.Context, id string) (MessageBatch, error) {
+	var batch MessageBatch
+	err := c.doJSON(ctx, http.MethodGet, batchPath(id), nil, &batch)
+	return batch, err
+}
+
+// ListMessageBatches returns a page of the batches of the workspace, most recent first.
+func (c *Client) ListMessageBatches(ctx context.Context, opts ListOptions) (Page[MessageBatch], error) {
+	var page Page[MessageBatch]
+	err := c.doJSON(ctx, http.MethodGet, withQuery(RequestTypeMessageBatches, opts.values()), nil, &page)
+	return page, err
+}
+
+// IterateMessageBatches returns an iterator over all the batches of the workspace.
+func (c *Client) IterateMessageBatches(ctx context.Context, opts ListOptions) *PageIterator[MessageBatch] {
+	return newPageIterator(ctx, opts, c.ListMessageBatches)
+}
+
+// CancelMessageBatch cancels a batch. Requests that are already processing finish and the
+// batch stays in the canceling status until they do.
+func (c *Client) CancelMessageBatch(ctx context.Context, id string) (MessageBatch, error) {
+	var batch MessageBatch
+	err := c.doJSON(ctx, http.MethodPost, batchPath(id)+"/cancel", nil, &batch)
+	return batch, err
+}
+
+// DeleteMessageBatch deletes a batch that has ended.
+func (c *Client) DeleteMessageBatch(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, batchPath(id), nil, nil)
+}
+
+// MessageBatchResults streams the results of an ended batch. The results are decoded one at
+// a time as they are read; the decoder must be closed.
+func (c *Client) MessageBatchResults(ctx context.Context, id string) (*BatchResultsDecoder, error) {
+	req, cancel, err := c.newRequest(ctx, http.MethodGet, batchPath(id)+"/results", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.doRequestWithRetries(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		defer cancel()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, newAPIError(res, body)
+	}
+
+	return &BatchResultsDecoder{decoder: json.NewDecoder(res.Body), body: res.Body, cancel: cancel}, nil
+}
+
+// BatchResultsDecoder decodes the JSONL results file of a batch.
+type BatchResultsDecoder struct {
+	decoder *json.Decoder
+	body    io.ReadCloser
+	cancel  context.CancelFunc
+}
+
+// NewBatchResultsDecoder returns a decoder reading results from r, e.g. a results file that
+// was saved to disk.
+func NewBatchResultsDecoder(r io.Reader) *BatchResultsDecoder {
+	return &BatchResultsDecoder{decoder: json.NewDecoder(r)}
+}
+
+// Decode returns the next result, or nil when all results were read.
+func (d *BatchResultsDecoder) Decode() (*BatchResult, error) {
+	var result BatchResult
+	if err := d.decoder.Decode(&result); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Collect reads the remaining results, keyed by custom ID.
+func (d *BatchResultsDecoder) Collect() (map[string]BatchResult, error) {
+	results := map[string]BatchResult{}
+	for {
+		result, err := d.Decode()
+		if err != nil {
+			return results, err
+		}
+		if result == nil {
+			return results, nil
+		}
+		results[result.CustomID] = *result
+	}
+}
+
+// Close releases the underlying response.
+func (d *BatchResultsDecoder) Close() error {
+	if d.cancel != nil {
+		defer d.cancel()
+	}
+	if d.body != nil {
+		return d.body.Close()
+	}
+	return nil
+}
+
+func batchPath(id string) string {
+	return RequestTypeMessageBatches + "/" + url.PathEscape(id)
+}
+
+// batchRequestOptions returns the options of the request creating a batch of the requests.
+func batchRequestOptions(requests []BatchRequest) []requestOption {
+	for _, request := range requests {
+		if request.Params.usesFiles() {
+			return []requestOption{withBeta(FilesAPIBeta)}
+		}
+	}
+	return nil
+}
+
+// prepareBatchRequests validates the requests and returns them as they will be sent, along
+// with the encoded size of each.
+func (c *Client) prepareBatchRequests(requests []BatchRequest) ([]BatchRequest, []int, error) {
+	if len(requests) == 0 {
+		return nil, nil, errors.New("batch has no requests")
+	}
+
+	prepared := make([]BatchRequest, len(requests))
+	sizes := make([]int, len(requests))
+	seen := make(map[string]bool, len(requests))
+
+	for i, request := range requests {
+		if !customIDPattern.MatchString(request.CustomID) {
+			return nil, nil, fmt.Errorf("request %d: custom_id must be 1 to 64 letters, digits, - or _, got %q", i, request.CustomID)
+		}
+		if seen[request.CustomID] {
+			return nil, nil, fmt.Errorf("request %d: duplicate custom_id %q", i, request.CustomID)
+		}
+		seen[request.CustomID] = true
+
+		// batches cannot be streamed
+		request.Params.Stream = nil
+		request.Params = c.applyAutoCache(request.Params)
+		if err := request.Params.validate(); err != nil {
+			return nil, nil, fmt.Errorf("request %q: %w", request.CustomID, err)
+		}
+		if err := c.checkMessageModel(request.Params); err != nil {
+			return nil, nil, fmt.Errorf("request %q: %w", request.CustomID, err)
+		}
+
+		data, err := json.Marshal(request)
+		if err != nil {
+			return nil, nil, fmt.Errorf("request %q: %w", request.CustomID, err)
+		}
+
+		prepared[i] = request
+		sizes[i] = len(data)
+	}
+
+	return prepared, sizes, nil
+}
+
+// splitBatchRequests groups consecutive requests, given their encoded sizes, into ranges
+// [start, end) that fit in a batch.
+func splitBatchRequests(sizes []int, maxRequests, maxBytes int) ([][2]int, error) {
+	const envelope = len(`{"requests":[]}`)
+
+	var chunks [][2]int
+	start, size := 0, envelope
+	for i, requestSize := range sizes {
+		if envelope+requestSize > maxBytes {
+			return nil, fmt.Errorf("request %d alone is %d bytes: %w", i, requestSize, ErrBatchTooLarge)
+		}
+
+		// requests after the first are preceded by a comma
+		added := requestSize
+		if i > start {
+			added++
+		}
+
+		if i > start && (i-start >= maxRequests || size+added > maxBytes) {
+			chunks = append(chunks, [2]int{start, i})
+			start, size, added = i, envelope, requestSize
+		}
+		size += added
+	}
+
+	if start < len(sizes) {
+		chunks = append(chunks, [2]int{start, len(sizes)})
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,289 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const batchJSON = `{
+	"id": "msgbatch_1",
+	"type": "message_batch",
+	"processing_status": "in_progress",
+	"request_counts": {"processing": 2, "succeeded": 0, "errored": 0, "canceled": 0, "expired": 0},
+	"created_at": "2024-09-24T18:37:24.100435Z",
+	"expires_at": "2024-09-25T18:37:24.100435Z",
+	"ended_at": null,
+	"archived_at": null,
+	"cancel_initiated_at": null,
+	"results_url": null
+}`
+
+func batchRequest(customID, text string) BatchRequest {
+	return BatchRequest{CustomID: customID, Params: MessagePayload{
+		Model:     ModelClaude3Haiku,
+		MaxTokens: 10,
+		Messages:  conversation(text),
+	}}
+}
+
+func TestClient_CreateMessageBatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages/batches", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var payload struct {
+			Requests []json.RawMessage `json:"requests"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		require.Len(t, payload.Requests, 2)
+		assert.JSONEq(t, `{"custom_id": "a", "params": {"model": "claude-3-haiku-20240307", "max_tokens": 10, "messages": [{"role": "user", "content": [{"type": "text", "text": "first"}]}]}}`, string(payload.Requests[0]))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(batchJSON))
+	}))
+	defer ts.Close()
+
+	batch, err := newTestClient(t, ts.URL).CreateMessageBatch(context.Background(), []BatchRequest{
+		batchRequest("a", "first"),
+		batchRequest("b", "second"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "msgbatch_1", batch.ID)
+	assert.Equal(t, BatchStatusInProgress, batch.ProcessingStatus)
+	assert.Equal(t, 2, batch.RequestCounts.Processing)
+	assert.Equal(t, 2024, batch.CreatedAt.Year())
+	assert.Nil(t, batch.EndedAt)
+	assert.Nil(t, batch.ResultsURL)
+}
+
+func TestClient_CreateMessageBatchValidation(t *testing.T) {
+	client, err := NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		requests      []BatchRequest
+		expectedError string
+	}{
+		{
+			name:          "empty",
+			expectedError: "batch has no requests",
+		},
+		{
+			name:          "invalid custom id",
+			requests:      []BatchRequest{batchRequest("a b", "x")},
+			expectedError: `request 0: custom_id must be 1 to 64 letters, digits, - or _, got "a b"`,
+		},
+		{
+			name:          "duplicate custom id",
+			requests:      []BatchRequest{batchRequest("a", "x"), batchRequest("a", "y")},
+			expectedError: `request 1: duplicate custom_id "a"`,
+		},
+		{
+			name: "invalid params",
+			requests: []BatchRequest{{CustomID: "a", Params: MessagePayload{
+				Messages:   conversation("x"),
+				ToolChoice: &ToolChoice{Type: ToolChoiceAny},
+			}}},
+			expectedError: `request "a": tool_choice "any" requires at least one tool`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.CreateMessageBatch(context.Background(), tc.requests)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestSplitBatchRequests(t *testing.T) {
+	envelope := len(`{"requests":[]}`)
+
+	chunks, err := splitBatchRequests([]int{10, 10, 10, 10, 10}, 2, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 2}, {2, 4}, {4, 5}}, chunks)
+
+	// two requests and a comma fit exactly, the third one does not
+	chunks, err = splitBatchRequests([]int{10, 10, 10}, 100, envelope+21)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 2}, {2, 3}}, chunks)
+
+	_, err = splitBatchRequests([]int{10, 30}, 100, envelope+20)
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+	assert.EqualError(t, err, "request 1 alone is 30 bytes: batch exceeds the request count or size limit")
+}
+
+func TestClient_CreateMessageBatches(t *testing.T) {
+	var sizes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload createMessageBatchPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		sizes = append(sizes, len(payload.Requests))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "msgbatch_%d", "processing_status": "in_progress"}`, len(sizes))
+	}))
+	defer ts.Close()
+
+	requests := make([]BatchRequest, MaxBatchRequests+1)
+	for i := range requests {
+		requests[i] = batchRequest(fmt.Sprintf("r%d", i), "x")
+	}
+
+	batches, err := newTestClient(t, ts.URL).CreateMessageBatches(context.Background(), requests)
+	require.NoError(t, err)
+
+	require.Len(t, batches, 2)
+	assert.Equal(t, "msgbatch_2", batches[1].ID)
+	assert.Equal(t, []int{MaxBatchRequests, 1}, sizes)
+
+	_, err = newTestClient(t, ts.URL).CreateMessageBatch(context.Background(), requests)
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+}
+
+func TestClient_MessageBatchEndpoints(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /messages/batches/msgbatch_1":
+			w.Write([]byte(batchJSON))
+		case "POST /messages/batches/msgbatch_1/cancel":
+			w.Write([]byte(`{"id": "msgbatch_1", "processing_status": "canceling", "cancel_initiated_at": "2024-09-24T18:40:00Z"}`))
+		case "DELETE /messages/batches/msgbatch_1":
+			w.Write([]byte(`{"id": "msgbatch_1", "type": "message_batch_deleted"}`))
+		case "GET /messages/batches":
+			assert.Equal(t, "5", r.URL.Query().Get("limit"))
+			assert.Equal(t, "msgbatch_0", r.URL.Query().Get("after_id"))
+			w.Write([]byte(`{"data": [{"id": "msgbatch_1"}, {"id": "msgbatch_2"}], "has_more": true, "first_id": "msgbatch_1", "last_id": "msgbatch_2"}`))
+		default:
+			w.Header().Set("request-id", "req_1")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": {"type": "not_found_error", "message": "Not found"}}`))
+		}
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	batch, err := client.RetrieveMessageBatch(ctx, "msgbatch_1")
+	require.NoError(t, err)
+	assert.Equal(t, "msgbatch_1", batch.ID)
+
+	batch, err = client.CancelMessageBatch(ctx, "msgbatch_1")
+	require.NoError(t, err)
+	assert.Equal(t, BatchStatusCanceling, batch.ProcessingStatus)
+	require.NotNil(t, batch.CancelInitiatedAt)
+
+	require.NoError(t, client.DeleteMessageBatch(ctx, "msgbatch_1"))
+
+	page, err := client.ListMessageBatches(ctx, ListOptions{Limit: 5, AfterID: "msgbatch_0"})
+	require.NoError(t, err)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "msgbatch_2", page.LastID)
+	assert.Len(t, page.Data, 2)
+
+	_, err = client.RetrieveMessageBatch(ctx, "missing")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "req_1", apiErr.RequestID)
+	assert.EqualError(t, err, "not_found_error: Not found")
+}
+
+func TestClient_MessageBatchResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages/batches/msgbatch_1/results", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/binary")
+		w.Write([]byte(`{"custom_id": "a", "result": {"type": "succeeded", "message": {"id": "msg_1", "content": [{"type": "text", "text": "positive"}], "usage": {"input_tokens": 5, "output_tokens": 1}}}}
+{"custom_id": "b", "result": {"type": "errored", "error": {"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: Field required"}}}}
+{"custom_id": "c", "result": {"type": "canceled"}}
+{"custom_id": "d", "result": {"type": "expired"}}
+`))
+	}))
+	defer ts.Close()
+
+	results, err := newTestClient(t, ts.URL).MessageBatchResults(context.Background(), "msgbatch_1")
+	require.NoError(t, err)
+	defer results.Close()
+
+	result, err := results.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "a", result.CustomID)
+	assert.Equal(t, BatchResultSucceeded, result.Result.Type)
+	assert.Equal(t, "positive", result.Result.Message.Content[0].Text)
+	assert.NoError(t, result.Err())
+
+	rest, err := results.Collect()
+	require.NoError(t, err)
+	require.Len(t, rest, 3)
+	assert.EqualError(t, rest["b"].Err(), "invalid_request_error: max_tokens: Field required")
+	assert.Equal(t, BatchResultCanceled, rest["c"].Result.Type)
+	assert.Equal(t, BatchResultExpired, rest["d"].Result.Type)
+	assert.Nil(t, rest["d"].Result.Message)
+
+	result, err = results.Decode()
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestBatchResultsDecoder_Invalid(t *testing.T) {
+	decoder := NewBatchResultsDecoder(strings.NewReader(`{"custom_id": "a", "result": {"type": "canceled"}}
+{"custom_id": `))
+
+	result, err := decoder.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "a", result.CustomID)
+
+	_, err = decoder.Decode()
+	assert.Error(t, err)
+	assert.NoError(t, decoder.Close())
+}
+
+// flakyHttpClient fails the first request and records the bodies it receives.
+type flakyHttpClient struct {
+	calls  int
+	bodies []string
+}
+
+func (c *flakyHttpClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+	body, _ := io.ReadAll(req.Body)
+	c.bodies = append(c.bodies, string(body))
+	if c.calls == 1 {
+		return nil, errors.New("connection reset")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(batchJSON)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestClient_RetryResendsBody(t *testing.T) {
+	httpClient := &flakyHttpClient{}
+	client, err := NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+	client.httpClient = httpClient
+
+	_, err = client.CreateMessageBatch(context.Background(), []BatchRequest{batchRequest("a", "x")})
+	require.NoError(t, err)
+
+	require.Len(t, httpClient.bodies, 2)
+	assert.NotEmpty(t, httpClient.bodies[1])
+	assert.Equal(t, httpClient.bodies[0], httpClient.bodies[1])
+}
@@ -0,0 +1,100 @@
+package anthrogo
+
+import (
+	"fmt"
+)
+
+// MaxCacheBreakpoints is the maximum number of cache_control breakpoints allowed in a request.
+const MaxCacheBreakpoints = 4
+
+const (
+	// CacheControlTypeEphemeral is the only cache type currently supported by the API.
+	CacheControlTypeEphemeral = "ephemeral"
+
+	// CacheTTL5Minutes is the default lifetime of a cache entry.
+	CacheTTL5Minutes = "5m"
+	// CacheTTL1Hour extends the lifetime of a cache entry to one hour at a higher write cost.
+	CacheTTL1Hour = "1h"
+)
+
+// CacheControl marks a block as a prompt-cache breakpoint. Everything in the request up to
+// and including the block (tools, then system, then messages) is cached.
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+// NewEphemeralCacheControl returns an ephemeral cache breakpoint with the given TTL. An
+// empty TTL uses the API default of five minutes.
+func NewEphemeralCacheControl(ttl string) *CacheControl {
+	return &CacheControl{Type: CacheControlTypeEphemeral, TTL: ttl}
+}
+
+// CacheCreation breaks the cache write tokens down by TTL.
+type CacheCreation struct {
+	Ephemeral5mInputTokens int `json:"ephemeral_5m_input_tokens"`
+	Ephemeral1hInputTokens int `json:"ephemeral_1h_input_tokens"`
+}
+
+// validateCacheControl checks every cache_control breakpoint of the payload.
+func (p MessagePayload) validateCacheControl() error {
+	count := 0
+	err := p.walkCacheControl(func(cc *CacheControl, where string) error {
+		count++
+		if cc.Type != CacheControlTypeEphemeral {
+			return fmt.Errorf("%s: unknown cache_control type %q", where, cc.Type)
+		}
+		switch cc.TTL {
+		case "", CacheTTL5Minutes, CacheTTL1Hour:
+		default:
+			return fmt.Errorf("%s: unknown cache_control ttl %q", where, cc.TTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if count > MaxCacheBreakpoints {
+		return fmt.Errorf("request has %d cache_control breakpoints, at most %d are allowed", count, MaxCacheBreakpoints)
+	}
+
+	return nil
+}
+
+// walkCacheControl calls fn for every cache_control breakpoint of the payload in prompt
+// order, describing where the breakpoint is. It stops at the first error.
+func (p MessagePayload) walkCacheControl(fn func(cc *CacheControl, where string) error) error {
+	visit := func(cc *CacheControl, where string) error {
+		if cc == nil {
+			return nil
+		}
+		return fn(cc, where)
+	}
+
+	for _, tool := range p.Tools {
+		if err := visit(tool.CacheControl, fmt.Sprintf("tool %q", tool.Name)); err != nil {
+			return err
+		}
+	}
+	for i, block := range p.SystemBlocks {
+		if err := visit(block.CacheControl, fmt.Sprintf("system block %d", i)); err != nil {
+			return err
+		}
+	}
+	for i, message := range p.Messages {
+		for j, content := range message.Content {
+			where := fmt.Sprintf("message %d block %d", i, j)
+			if err := visit(content.CacheControl, where); err != nil {
+				return err
+			}
+			for _, nested := range content.Content {
+				if err := visit(nested.CacheControl, where); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
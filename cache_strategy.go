@@ -0,0 +1,167 @@
+package anthrogo
+
+// defaultMinCacheableTokens is the shortest prefix that can be cached on most models. It is
+// used for models whose ModelCapabilities do not set MinCacheableTokens.
+const defaultMinCacheableTokens = 1024
+
+// AutoCacheStrategy places prompt-cache breakpoints on message requests so that callers do
+// not have to. Breakpoints go, in order of priority, on the last tool definition, the last
+// system block, the last block of the conversation and the last block of the previous user
+// turn, so that each turn reads the prefix cached by the one before it. Existing breakpoints
+// are kept and count towards the limit of MaxCacheBreakpoints. A breakpoint is only placed
+// when the prefix it closes is long enough for the model to cache, as estimated offline by
+// EstimateTokens. The minimum length of each model is its MinCacheableTokens in the model
+// registry of the client.
+type AutoCacheStrategy struct {
+	// TTL of the placed breakpoints. Empty uses the API default of five minutes.
+	TTL string
+	// Disabled turns placement off, e.g. for a single request of a client created with
+	// WithAutoCache.
+	Disabled bool
+}
+
+// WithAutoCache is an option to place prompt-cache breakpoints automatically on every
+// MessageRequest and MessageStreamRequest made by the Client. MessagePayload.AutoCache
+// overrides it for a single request.
+func WithAutoCache(strategy AutoCacheStrategy) func(*Client) {
+	return func(c *Client) {
+		c.autoCache = &strategy
+	}
+}
+
+// CacheHitRatio returns the share of the prompt that was read from the cache, between 0
+// and 1. It is 0 when the usage reports no input tokens.
+func (u Usage) CacheHitRatio() float64 {
+	total := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	if total == 0 {
+		return 0
+	}
+	return float64(u.CacheReadInputTokens) / float64(total)
+}
+
+// applyAutoCache places breakpoints on the payload with its own strategy or, when it has
+// none, the strategy of the client.
+func (c *Client) applyAutoCache(payload MessagePayload) MessagePayload {
+	strategy := c.autoCache
+	if payload.AutoCache != nil {
+		strategy = payload.AutoCache
+	}
+	if strategy == nil || strategy.Disabled {
+		return payload
+	}
+
+	minTokens := defaultMinCacheableTokens
+	if capabilities, ok := c.models.Lookup(payload.Model); ok && capabilities.MinCacheableTokens > 0 {
+		minTokens = capabilities.MinCacheableTokens
+	}
+	return strategy.apply(payload, minTokens)
+}
+
+// cacheCandidate is a block that may be marked as a breakpoint.
+type cacheCandidate struct {
+	prefixTokens int
+	mark         func(cc *CacheControl)
+}
+
+// apply returns a copy of the payload with breakpoints placed on prefixes of at least
+// minTokens. The slices of the original payload are never modified.
+func (s AutoCacheStrategy) apply(payload MessagePayload, minTokens int) MessagePayload {
+	budget := MaxCacheBreakpoints - countCacheBreakpoints(payload)
+	if budget <= 0 {
+		return payload
+	}
+
+	if payload.System != nil && *payload.System != "" && len(payload.SystemBlocks) == 0 {
+		payload.SystemBlocks = []MessageContent{NewTextContent(*payload.System)}
+		payload.System = nil
+	}
+
+	payload.Tools = append([]Tool(nil), payload.Tools...)
+	payload.SystemBlocks = append([]MessageContent(nil), payload.SystemBlocks...)
+	payload.Messages = append([]Message(nil), payload.Messages...)
+
+	var candidates []cacheCandidate
+	estimator := defaultTokenEstimator
+	prefix := estimator.tools(payload.Tools).total(1)
+
+	if n := len(payload.Tools); n > 0 && payload.Tools[n-1].CacheControl == nil {
+		candidates = append(candidates, cacheCandidate{prefix, func(cc *CacheControl) {
+			payload.Tools[n-1].CacheControl = cc
+		}})
+	}
+
+	prefix += estimator.blocks(payload.SystemBlocks).total(1)
+	if n := len(payload.SystemBlocks); n > 0 && cacheable(payload.SystemBlocks[n-1]) {
+		candidates = append(candidates, cacheCandidate{prefix, func(cc *CacheControl) {
+			payload.SystemBlocks[n-1].CacheControl = cc
+		}})
+	}
+
+	messagePrefix := make([]int, len(payload.Messages))
+	for i, message := range payload.Messages {
+		prefix += estimator.message(message).total(1)
+		messagePrefix[i] = prefix
+	}
+
+	last := len(payload.Messages) - 1
+	previousUser := -1
+	for i := last - 1; i >= 0; i-- {
+		if payload.Messages[i].Role == RoleTypeUser {
+			previousUser = i
+			break
+		}
+	}
+
+	for _, i := range []int{last, previousUser} {
+		if i < 0 || len(payload.Messages[i].Content) == 0 {
+			continue
+		}
+		i := i
+		j := len(payload.Messages[i].Content) - 1
+		if !cacheable(payload.Messages[i].Content[j]) {
+			continue
+		}
+		candidates = append(candidates, cacheCandidate{messagePrefix[i], func(cc *CacheControl) {
+			content := append([]MessageContent(nil), payload.Messages[i].Content...)
+			content[j].CacheControl = cc
+			payload.Messages[i].Content = content
+		}})
+	}
+
+	for _, candidate := range candidates {
+		if budget == 0 {
+			break
+		}
+		if candidate.prefixTokens < minTokens {
+			continue
+		}
+		candidate.mark(NewEphemeralCacheControl(s.TTL))
+		budget--
+	}
+
+	return payload
+}
+
+// cacheable reports whether a block can carry a breakpoint that was not already placed.
+func cacheable(content MessageContent) bool {
+	if content.CacheControl != nil {
+		return false
+	}
+	if content.Type == ContentTypeThinking || content.Type == ContentTypeRedactedThinking {
+		return false
+	}
+	if content.Type == ContentTypeText && (content.Text == nil || *content.Text == "") {
+		return false
+	}
+	return true
+}
+
+// countCacheBreakpoints counts the breakpoints already present in the payload.
+func countCacheBreakpoints(payload MessagePayload) int {
+	count := 0
+	_ = payload.walkCacheControl(func(*CacheControl, string) error {
+		count++
+		return nil
+	})
+	return count
+}
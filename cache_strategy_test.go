@@ -0,0 +1,166 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func conversation(turns ...string) []Message {
+	messages := make([]Message, len(turns))
+	for i, turn := range turns {
+		role := RoleTypeUser
+		if i%2 == 1 {
+			role = RoleTypeAssistant
+		}
+		messages[i] = Message{Role: role, Content: []MessageContent{NewTextContent(turn)}}
+	}
+	return messages
+}
+
+func TestAutoCacheStrategy_Apply(t *testing.T) {
+	long := strings.Repeat("lorem ipsum ", 1000)
+	system := long
+
+	original := MessagePayload{
+		Model:    ModelClaude3Dot5Sonnet,
+		System:   &system,
+		Tools:    []Tool{{Name: "a", InputSchema: map[string]any{"type": "object"}}, {Name: "b", InputSchema: map[string]any{"type": "object"}}},
+		Messages: conversation("first question", "first answer", "second question"),
+	}
+
+	payload := AutoCacheStrategy{TTL: CacheTTL1Hour}.apply(original, defaultMinCacheableTokens)
+
+	// the tools alone are too short to be cached
+	assert.Nil(t, payload.Tools[1].CacheControl)
+
+	require.Len(t, payload.SystemBlocks, 1)
+	assert.Nil(t, payload.System)
+	assert.Equal(t, NewEphemeralCacheControl(CacheTTL1Hour), payload.SystemBlocks[0].CacheControl)
+	assert.Equal(t, NewEphemeralCacheControl(CacheTTL1Hour), payload.Messages[2].Content[0].CacheControl)
+	assert.Equal(t, NewEphemeralCacheControl(CacheTTL1Hour), payload.Messages[0].Content[0].CacheControl)
+	assert.Nil(t, payload.Messages[1].Content[0].CacheControl)
+	assert.NoError(t, payload.validate())
+
+	// the caller's payload is left untouched
+	assert.NotNil(t, original.System)
+	assert.Nil(t, original.Messages[0].Content[0].CacheControl)
+	assert.Nil(t, original.Messages[2].Content[0].CacheControl)
+}
+
+func TestAutoCacheStrategy_ApplyRespectsLimits(t *testing.T) {
+	long := strings.Repeat("lorem ipsum ", 1000)
+
+	registry := NewModelRegistry()
+	registry.Register("claude-small-cache", ModelCapabilities{ContextWindow: 200_000, MaxOutputTokens: 4096, Messages: true, MinCacheableTokens: 10})
+	client, err := NewClient(WithApiKey("fake-key"), WithModelRegistry(registry), WithAutoCache(AutoCacheStrategy{}))
+	require.NoError(t, err)
+
+	t.Run("short prompt", func(t *testing.T) {
+		payload := client.applyAutoCache(MessagePayload{
+			Model:    ModelClaude3Haiku,
+			Messages: conversation(strings.Repeat("x", 6000)),
+		})
+		assert.Nil(t, payload.Messages[0].Content[0].CacheControl)
+
+		// the minimum of most models is lower than the one of Claude 3 Haiku
+		payload = client.applyAutoCache(MessagePayload{
+			Model:    ModelClaude3Opus,
+			Messages: conversation(strings.Repeat("x", 6000)),
+		})
+		assert.NotNil(t, payload.Messages[0].Content[0].CacheControl)
+	})
+
+	t.Run("registered minimum", func(t *testing.T) {
+		payload := client.applyAutoCache(MessagePayload{
+			Model:    "claude-small-cache",
+			Messages: conversation(strings.Repeat("x", 100)),
+		})
+		assert.NotNil(t, payload.Messages[0].Content[0].CacheControl)
+	})
+
+	t.Run("existing breakpoints", func(t *testing.T) {
+		blocks := make([]MessageContent, 3)
+		for i := range blocks {
+			blocks[i] = NewTextContent(long)
+			blocks[i].CacheControl = NewEphemeralCacheControl("")
+		}
+
+		payload := client.applyAutoCache(MessagePayload{
+			Model:        ModelClaude3Opus,
+			Tools:        []Tool{{Name: "a", InputSchema: map[string]any{"description": long}}},
+			SystemBlocks: blocks,
+			Messages:     conversation(long, long, long),
+		})
+
+		assert.NotNil(t, payload.Tools[0].CacheControl)
+		assert.Nil(t, payload.Messages[2].Content[0].CacheControl)
+		assert.Equal(t, MaxCacheBreakpoints, countCacheBreakpoints(payload))
+	})
+}
+
+func TestClient_MessageRequestAutoCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload MessagePayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		require.Len(t, payload.SystemBlocks, 1)
+		assert.NotNil(t, payload.SystemBlocks[0].CacheControl)
+		assert.NotNil(t, payload.Messages[0].Content[0].CacheControl)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 2990}}`))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithApiKey("fake-key"), WithAutoCache(AutoCacheStrategy{}))
+	require.NoError(t, err)
+	client.baseURL = ts.URL + "/"
+
+	system := strings.Repeat("lorem ipsum ", 1000)
+	resp, err := client.MessageRequest(context.Background(), MessagePayload{
+		Model:     ModelClaude3Dot5Sonnet,
+		System:    &system,
+		Messages:  conversation("hello"),
+		MaxTokens: 10,
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.9967, resp.Usage.CacheHitRatio(), 0.0001)
+}
+
+func TestClient_ApplyAutoCacheOverride(t *testing.T) {
+	long := strings.Repeat("lorem ipsum ", 1000)
+
+	client, err := NewClient(WithApiKey("fake-key"), WithAutoCache(AutoCacheStrategy{}))
+	require.NoError(t, err)
+
+	payload := client.applyAutoCache(MessagePayload{Model: ModelClaude3Opus, Messages: conversation(long)})
+	assert.Equal(t, NewEphemeralCacheControl(""), payload.Messages[0].Content[0].CacheControl)
+
+	payload = client.applyAutoCache(MessagePayload{Model: ModelClaude3Opus, Messages: conversation(long), AutoCache: &AutoCacheStrategy{TTL: CacheTTL1Hour}})
+	assert.Equal(t, NewEphemeralCacheControl(CacheTTL1Hour), payload.Messages[0].Content[0].CacheControl)
+
+	payload = client.applyAutoCache(MessagePayload{Model: ModelClaude3Opus, Messages: conversation(long), AutoCache: &AutoCacheStrategy{Disabled: true}})
+	assert.Nil(t, payload.Messages[0].Content[0].CacheControl)
+
+	// a request can opt in when the client has no strategy
+	client, err = NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+
+	payload = client.applyAutoCache(MessagePayload{Model: ModelClaude3Opus, Messages: conversation(long)})
+	assert.Nil(t, payload.Messages[0].Content[0].CacheControl)
+
+	payload = client.applyAutoCache(MessagePayload{Model: ModelClaude3Opus, Messages: conversation(long), AutoCache: &AutoCacheStrategy{}})
+	assert.NotNil(t, payload.Messages[0].Content[0].CacheControl)
+}
+
+func TestUsage_CacheHitRatio(t *testing.T) {
+	assert.Equal(t, float64(0), Usage{}.CacheHitRatio())
+	assert.Equal(t, 0.5, Usage{InputTokens: 10, CacheCreationInputTokens: 40, CacheReadInputTokens: 50}.CacheHitRatio())
+}
@@ -0,0 +1,153 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagePayload_MarshalSystem(t *testing.T) {
+	system := "be brief"
+
+	data, err := json.Marshal(MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, System: &system})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model": "claude-3-haiku-20240307", "messages": null, "max_tokens": 10, "system": "be brief"}`, string(data))
+
+	prompt := NewTextContent("a long shared prompt")
+	prompt.CacheControl = NewEphemeralCacheControl(CacheTTL1Hour)
+	payload := MessagePayload{
+		Model:        ModelClaude3Haiku,
+		MaxTokens:    10,
+		SystemBlocks: []MessageContent{prompt},
+		Tools: []Tool{{
+			Name:         "lookup",
+			InputSchema:  map[string]any{"type": "object"},
+			CacheControl: NewEphemeralCacheControl(""),
+		}},
+	}
+
+	data, err = json.Marshal(payload)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"model": "claude-3-haiku-20240307",
+		"messages": null,
+		"max_tokens": 10,
+		"system": [{"type": "text", "text": "a long shared prompt", "cache_control": {"type": "ephemeral", "ttl": "1h"}}],
+		"tools": [{"name": "lookup", "input_schema": {"type": "object"}, "cache_control": {"type": "ephemeral"}}]
+	}`, string(data))
+
+	var decoded MessagePayload
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Nil(t, decoded.System)
+	assert.Equal(t, payload.SystemBlocks, decoded.SystemBlocks)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"system": "be brief"}`), &decoded))
+	assert.Equal(t, "be brief", *decoded.System)
+	assert.Nil(t, decoded.SystemBlocks)
+}
+
+func TestMessagePayload_ValidateCacheControl(t *testing.T) {
+	system := "x"
+	breakpoint := func() MessageContent {
+		content := NewTextContent("x")
+		content.CacheControl = NewEphemeralCacheControl("")
+		return content
+	}
+
+	testCases := []struct {
+		name          string
+		payload       MessagePayload
+		expectedError string
+	}{
+		{
+			name: "four breakpoints",
+			payload: MessagePayload{
+				SystemBlocks: []MessageContent{breakpoint()},
+				Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+					breakpoint(), breakpoint(), NewToolResultContent("t", breakpoint()),
+				}}},
+			},
+		},
+		{
+			name: "too many breakpoints",
+			payload: MessagePayload{
+				SystemBlocks: []MessageContent{breakpoint(), breakpoint()},
+				Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+					breakpoint(), breakpoint(), breakpoint(),
+				}}},
+			},
+			expectedError: "request has 5 cache_control breakpoints, at most 4 are allowed",
+		},
+		{
+			name: "unknown ttl",
+			payload: MessagePayload{
+				Tools: []Tool{{Name: "t", InputSchema: map[string]any{}, CacheControl: NewEphemeralCacheControl("1d")}},
+			},
+			expectedError: `tool "t": unknown cache_control ttl "1d"`,
+		},
+		{
+			name: "unknown type",
+			payload: MessagePayload{
+				SystemBlocks: []MessageContent{{Type: ContentTypeText, Text: &system, CacheControl: &CacheControl{Type: "forever"}}},
+			},
+			expectedError: `system block 0: unknown cache_control type "forever"`,
+		},
+		{
+			name: "both system prompts",
+			payload: MessagePayload{
+				System:       &system,
+				SystemBlocks: []MessageContent{NewTextContent("x")},
+			},
+			expectedError: "only one of System and SystemBlocks may be set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.payload.validate()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUsage_CacheFields(t *testing.T) {
+	var resp MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(`{"usage": {
+		"input_tokens": 10,
+		"output_tokens": 20,
+		"cache_creation_input_tokens": 1000,
+		"cache_read_input_tokens": 3000,
+		"cache_creation": {"ephemeral_5m_input_tokens": 400, "ephemeral_1h_input_tokens": 600}
+	}}`), &resp))
+
+	expected := Usage{
+		InputTokens:              10,
+		OutputTokens:             20,
+		CacheCreationInputTokens: 1000,
+		CacheReadInputTokens:     3000,
+		CacheCreation:            &CacheCreation{Ephemeral5mInputTokens: 400, Ephemeral1hInputTokens: 600},
+	}
+	assert.Equal(t, expected, resp.Usage)
+
+	var total Usage
+	total.add(resp.Usage)
+	total.add(resp.Usage)
+	assert.Equal(t, 6000, total.CacheReadInputTokens)
+	assert.Equal(t, 1200, total.CacheCreation.Ephemeral1hInputTokens)
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(`event: message_start
+data: {"type": "message_start", "message": {"id": "1", "usage": {"input_tokens": 5, "output_tokens": 1, "cache_creation_input_tokens": 7, "cache_read_input_tokens": 9}}}
+`))
+	event, err := decoder.Decode()
+	require.NoError(t, err)
+	usage := event.Data.Data.(MessageStart).Message.Usage
+	assert.Equal(t, 7, usage.CacheCreationInputTokens)
+	assert.Equal(t, 9, usage.CacheReadInputTokens)
+}
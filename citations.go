@@ -0,0 +1,260 @@
+package anthrogo
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+// AnnotatedResponse is the text of a response with its citations resolved against the
+// documents of the request, ready to be rendered with Markdown or HTML.
+type AnnotatedResponse struct {
+	// Segments are the text blocks of the response in order.
+	Segments []AnnotatedSegment
+	// Sources is the bibliography: one entry per distinct cited passage, numbered from 1
+	// in order of first use.
+	Sources []CitationSource
+	// Mismatches lists the sources whose cited text does not match the passage found at
+	// the cited location of the document.
+	Mismatches []CitationMismatch
+}
+
+// AnnotatedSegment is a text block and the numbers of the sources that back it.
+type AnnotatedSegment struct {
+	Text      string
+	Footnotes []int
+}
+
+// CitationSource is a cited passage of a document.
+type CitationSource struct {
+	Number   int
+	Citation Citation
+	// Title is the title of the cited document, if it has one.
+	Title string
+	// Location describes where the passage is, e.g. "characters 10-25" or "page 3".
+	Location string
+	// Text is the passage found at the cited location, or the cited text when the
+	// document content is not available (PDFs, files, documents not passed in).
+	Text string
+	// Resolved reports whether Text was read from the document itself.
+	Resolved bool
+}
+
+// CitationMismatch is a source whose cited text differs from the document.
+type CitationMismatch struct {
+	Number int
+	// CitedText is the text the model cited.
+	CitedText string
+	// SourceText is the text found at the cited location, empty if the location is
+	// outside of the document.
+	SourceText string
+	Reason     string
+}
+
+// DocumentsFromPayload returns the document blocks of the payload in the order used by
+// Citation.DocumentIndex.
+func DocumentsFromPayload(payload MessagePayload) []MessageContent {
+	var documents []MessageContent
+	for _, message := range payload.Messages {
+		for _, content := range message.Content {
+			if content.Type == ContentTypeDocument {
+				documents = append(documents, content)
+			}
+		}
+	}
+	return documents
+}
+
+// AnnotateCitations resolves the citations of the text blocks of resp against the documents
+// that were sent with the request, as returned by DocumentsFromPayload.
+func AnnotateCitations(resp MessageResponse, documents []MessageContent) AnnotatedResponse {
+	var annotated AnnotatedResponse
+	numbers := map[string]int{}
+
+	for _, block := range resp.Content {
+		if block.Type != string(ContentTypeText) {
+			continue
+		}
+
+		segment := AnnotatedSegment{Text: block.Text}
+		for _, citation := range block.Citations {
+			key := citationKey(citation)
+			number, seen := numbers[key]
+			if !seen {
+				number = len(annotated.Sources) + 1
+				numbers[key] = number
+
+				source, mismatch := resolveCitation(number, citation, documents)
+				annotated.Sources = append(annotated.Sources, source)
+				if mismatch != nil {
+					annotated.Mismatches = append(annotated.Mismatches, *mismatch)
+				}
+			}
+			if !slices.Contains(segment.Footnotes, number) {
+				segment.Footnotes = append(segment.Footnotes, number)
+			}
+		}
+
+		annotated.Segments = append(annotated.Segments, segment)
+	}
+
+	return annotated
+}
+
+// Markdown renders the response with footnote markers and a list of footnotes.
+func (a AnnotatedResponse) Markdown() string {
+	var sb strings.Builder
+
+	for _, segment := range a.Segments {
+		sb.WriteString(segment.Text)
+		for _, number := range segment.Footnotes {
+			fmt.Fprintf(&sb, "[^%d]", number)
+		}
+	}
+
+	if len(a.Sources) > 0 {
+		sb.WriteString("\n\n")
+	}
+	for _, source := range a.Sources {
+		fmt.Fprintf(&sb, "[^%d]: %s: \"%s\"\n", source.Number, source.label(), source.Text)
+	}
+
+	return sb.String()
+}
+
+// HTML renders the response as a paragraph with superscript links to an ordered list of
+// sources. All text is escaped.
+func (a AnnotatedResponse) HTML() string {
+	var sb strings.Builder
+
+	sb.WriteString("<p>")
+	for _, segment := range a.Segments {
+		sb.WriteString(html.EscapeString(segment.Text))
+		for _, number := range segment.Footnotes {
+			fmt.Fprintf(&sb, `<sup><a href="#cite-%d">[%d]</a></sup>`, number, number)
+		}
+	}
+	sb.WriteString("</p>")
+
+	if len(a.Sources) > 0 {
+		sb.WriteString(`<ol class="citations">`)
+		for _, source := range a.Sources {
+			fmt.Fprintf(&sb, `<li id="cite-%d">%s: <q>%s</q></li>`,
+				source.Number, html.EscapeString(source.label()), html.EscapeString(source.Text))
+		}
+		sb.WriteString("</ol>")
+	}
+
+	return sb.String()
+}
+
+// label returns the title and location of the source.
+func (s CitationSource) label() string {
+	title := s.Title
+	if title == "" {
+		title = fmt.Sprintf("Document %d", s.Citation.DocumentIndex+1)
+	}
+	if s.Location == "" {
+		return title
+	}
+	return title + ", " + s.Location
+}
+
+// resolveCitation builds the bibliography entry of a citation and checks its cited text
+// against the document.
+func resolveCitation(number int, citation Citation, documents []MessageContent) (CitationSource, *CitationMismatch) {
+	source := CitationSource{
+		Number:   number,
+		Citation: citation,
+		Title:    citation.DocumentTitle,
+		Location: citationLocation(citation),
+		Text:     citation.CitedText,
+	}
+
+	if citation.DocumentIndex < 0 || citation.DocumentIndex >= len(documents) {
+		return source, nil
+	}
+
+	document := documents[citation.DocumentIndex]
+	if source.Title == "" {
+		source.Title = document.Title
+	}
+
+	text, ok, reason := passage(citation, document.Document)
+	if reason != "" {
+		return source, &CitationMismatch{Number: number, CitedText: citation.CitedText, Reason: reason}
+	}
+	if !ok {
+		return source, nil
+	}
+
+	source.Text = text
+	source.Resolved = true
+	if strings.TrimSpace(text) != strings.TrimSpace(citation.CitedText) {
+		return source, &CitationMismatch{
+			Number:     number,
+			CitedText:  citation.CitedText,
+			SourceText: text,
+			Reason:     "cited text does not match the document",
+		}
+	}
+
+	return source, nil
+}
+
+// passage returns the text at the cited location of the document. ok is false when the
+// document content is not available; reason is set when the location is invalid.
+func passage(citation Citation, document *DocumentSource) (text string, ok bool, reason string) {
+	if document == nil {
+		return "", false, ""
+	}
+
+	switch {
+	case citation.Type == CitationCharLocation && document.Type == DocumentSourceText:
+		runes := []rune(document.Data)
+		if citation.StartCharIndex < 0 || citation.EndCharIndex > len(runes) || citation.StartCharIndex > citation.EndCharIndex {
+			return "", false, fmt.Sprintf("characters %d-%d are outside of the document", citation.StartCharIndex, citation.EndCharIndex)
+		}
+		return string(runes[citation.StartCharIndex:citation.EndCharIndex]), true, ""
+	case citation.Type == CitationContentBlockLocation && document.Type == DocumentSourceContent:
+		if citation.StartBlockIndex < 0 || citation.EndBlockIndex > len(document.Content) || citation.StartBlockIndex > citation.EndBlockIndex {
+			return "", false, fmt.Sprintf("blocks %d-%d are outside of the document", citation.StartBlockIndex, citation.EndBlockIndex)
+		}
+		var sb strings.Builder
+		for _, block := range document.Content[citation.StartBlockIndex:citation.EndBlockIndex] {
+			if block.Text != nil {
+				sb.WriteString(*block.Text)
+			}
+		}
+		return sb.String(), true, ""
+	default:
+		return "", false, ""
+	}
+}
+
+// citationLocation describes the location of a citation for display. Indices are shown as
+// they are returned by the API, page numbers are shown inclusively.
+func citationLocation(citation Citation) string {
+	switch citation.Type {
+	case CitationCharLocation:
+		return fmt.Sprintf("characters %d-%d", citation.StartCharIndex, citation.EndCharIndex)
+	case CitationPageLocation:
+		last := citation.EndPageNumber - 1
+		if last <= citation.StartPageNumber {
+			return fmt.Sprintf("page %d", citation.StartPageNumber)
+		}
+		return fmt.Sprintf("pages %d-%d", citation.StartPageNumber, last)
+	case CitationContentBlockLocation:
+		return fmt.Sprintf("blocks %d-%d", citation.StartBlockIndex, citation.EndBlockIndex)
+	default:
+		return ""
+	}
+}
+
+// citationKey identifies a cited passage so that repeated citations share a footnote.
+func citationKey(citation Citation) string {
+	return fmt.Sprintf("%d|%s|%d|%d|%d|%d|%d|%d|%s", citation.DocumentIndex, citation.Type,
+		citation.StartCharIndex, citation.EndCharIndex, citation.StartPageNumber, citation.EndPageNumber,
+		citation.StartBlockIndex, citation.EndBlockIndex, citation.CitedText)
+}
@@ -0,0 +1,113 @@
+package anthrogo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func citedResponse() (MessageResponse, []MessageContent) {
+	payload := MessagePayload{Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+		NewDocumentContent(NewTextDocumentSource("The grass is green. The sky is blue."), "Facts", true),
+		NewDocumentContent(NewPDFDocumentSource([]byte("%PDF")), "Report", true),
+		NewDocumentContent(NewContentDocumentSource(NewTextContent("Water is wet."), NewTextContent(" Fire is hot.")), "", true),
+		NewTextContent("Tell me about the world."),
+	}}}}
+
+	resp := MessageResponse{Content: []ContentBlock{
+		{Type: "text", Text: "According to the documents, "},
+		{Type: "text", Text: "the grass is green", Citations: []Citation{
+			{Type: CitationCharLocation, CitedText: "The grass is green.", DocumentIndex: 0, DocumentTitle: "Facts", StartCharIndex: 0, EndCharIndex: 19},
+		}},
+		{Type: "text", Text: " and <revenue> grew", Citations: []Citation{
+			{Type: CitationPageLocation, CitedText: "Revenue grew 5%.", DocumentIndex: 1, StartPageNumber: 2, EndPageNumber: 3},
+			{Type: CitationCharLocation, CitedText: "The grass is green.", DocumentIndex: 0, DocumentTitle: "Facts", StartCharIndex: 0, EndCharIndex: 19},
+		}},
+		{Type: "text", Text: ", while water is wet.", Citations: []Citation{
+			{Type: CitationContentBlockLocation, CitedText: "Water is wet.", DocumentIndex: 2, StartBlockIndex: 0, EndBlockIndex: 1},
+			{Type: CitationCharLocation, CitedText: "The sky is red.", DocumentIndex: 0, StartCharIndex: 20, EndCharIndex: 36},
+		}},
+	}}
+
+	return resp, DocumentsFromPayload(payload)
+}
+
+func TestAnnotateCitations(t *testing.T) {
+	resp, documents := citedResponse()
+	require.Len(t, documents, 3)
+
+	annotated := AnnotateCitations(resp, documents)
+
+	require.Len(t, annotated.Segments, 4)
+	assert.Empty(t, annotated.Segments[0].Footnotes)
+	assert.Equal(t, []int{1}, annotated.Segments[1].Footnotes)
+	assert.Equal(t, []int{2, 1}, annotated.Segments[2].Footnotes)
+	assert.Equal(t, []int{3, 4}, annotated.Segments[3].Footnotes)
+
+	require.Len(t, annotated.Sources, 4)
+	assert.Equal(t, CitationSource{
+		Number:   1,
+		Citation: resp.Content[1].Citations[0],
+		Title:    "Facts",
+		Location: "characters 0-19",
+		Text:     "The grass is green.",
+		Resolved: true,
+	}, annotated.Sources[0])
+
+	assert.Equal(t, "Report", annotated.Sources[1].Title)
+	assert.Equal(t, "page 2", annotated.Sources[1].Location)
+	assert.False(t, annotated.Sources[1].Resolved)
+
+	assert.Equal(t, "", annotated.Sources[2].Title)
+	assert.Equal(t, "Water is wet.", annotated.Sources[2].Text)
+	assert.True(t, annotated.Sources[2].Resolved)
+
+	assert.Equal(t, "The sky is blue.", annotated.Sources[3].Text)
+	assert.Equal(t, []CitationMismatch{{
+		Number:     4,
+		CitedText:  "The sky is red.",
+		SourceText: "The sky is blue.",
+		Reason:     "cited text does not match the document",
+	}}, annotated.Mismatches)
+}
+
+func TestAnnotateCitations_OutOfRange(t *testing.T) {
+	documents := []MessageContent{NewDocumentContent(NewTextDocumentSource("short"), "", true)}
+	resp := MessageResponse{Content: []ContentBlock{{Type: "text", Text: "x", Citations: []Citation{
+		{Type: CitationCharLocation, CitedText: "missing", StartCharIndex: 2, EndCharIndex: 40},
+		{Type: CitationCharLocation, CitedText: "other document", DocumentIndex: 3, EndCharIndex: 5},
+	}}}}
+
+	annotated := AnnotateCitations(resp, documents)
+
+	assert.Equal(t, []CitationMismatch{{
+		Number:    1,
+		CitedText: "missing",
+		Reason:    "characters 2-40 are outside of the document",
+	}}, annotated.Mismatches)
+	assert.Equal(t, "Document 4, characters 0-5", annotated.Sources[1].label())
+}
+
+func TestAnnotatedResponse_Render(t *testing.T) {
+	resp, documents := citedResponse()
+	annotated := AnnotateCitations(resp, documents)
+
+	assert.Equal(t, `According to the documents, the grass is green[^1] and <revenue> grew[^2][^1], while water is wet.[^3][^4]
+
+[^1]: Facts, characters 0-19: "The grass is green."
+[^2]: Report, page 2: "Revenue grew 5%."
+[^3]: Document 3, blocks 0-1: "Water is wet."
+[^4]: Facts, characters 20-36: "The sky is blue."
+`, annotated.Markdown())
+
+	assert.Equal(t, `<p>According to the documents, the grass is green<sup><a href="#cite-1">[1]</a></sup>`+
+		` and &lt;revenue&gt; grew<sup><a href="#cite-2">[2]</a></sup><sup><a href="#cite-1">[1]</a></sup>`+
+		`, while water is wet.<sup><a href="#cite-3">[3]</a></sup><sup><a href="#cite-4">[4]</a></sup></p>`+
+		`<ol class="citations">`+
+		`<li id="cite-1">Facts, characters 0-19: <q>The grass is green.</q></li>`+
+		`<li id="cite-2">Report, page 2: <q>Revenue grew 5%.</q></li>`+
+		`<li id="cite-3">Document 3, blocks 0-1: <q>Water is wet.</q></li>`+
+		`<li id="cite-4">Facts, characters 20-36: <q>The sky is blue.</q></li>`+
+		`</ol>`, annotated.HTML())
+}
@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,6 +36,35 @@ type ErrorDetail struct {
 	Message string `json:"message"`
 }
 
+// APIError is returned when the API answers a request with an error.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	// RequestID identifies the request when reporting issues to Anthropic.
+	RequestID string
+}
+
+// Error formats the error as "type: message".
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// newAPIError builds the error of a failed response from its body.
+func newAPIError(res *http.Response, body []byte) error {
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		return fmt.Errorf("request failed and error response had unexpected form: %w", err)
+	}
+
+	return &APIError{
+		StatusCode: res.StatusCode,
+		Type:       errorResponse.Error.Type,
+		Message:    errorResponse.Error.Message,
+		RequestID:  res.Header.Get("request-id"),
+	}
+}
+
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -45,10 +78,22 @@ type Client struct {
 	customHeaders map[string]string
 	httpClient    HttpClient
 	apiKey        string
+	adminKey      string
+	autoCache     *AutoCacheStrategy
+
+	preflightTokenCheck bool
+
+	models *ModelRegistry
+	logger *slog.Logger
+	// deprecationWarnings records the deprecated models a warning was logged for.
+	deprecationWarnings sync.Map
+	// unknownModelWarnings records the models missing from the registry a warning was logged for.
+	unknownModelWarnings sync.Map
 }
 
 // NewClient creates and returns a new Client. It applies the provided options to the client.
 // If no API key is provided as an option, it looks for the API key in the environment variable ANTHROPIC_API_KEY.
+// A client given an admin key with WithAdminApiKey does not need an API key.
 func NewClient(options ...func(*Client)) (*Client, error) {
 	client := &Client{
 		version:    DefaultVersion,
@@ -57,6 +102,8 @@ func NewClient(options ...func(*Client)) (*Client, error) {
 		httpClient: &http.Client{},
 		apiKey:     "",
 		baseURL:    "https://api.anthropic.com/v1/",
+		models:     DefaultModelRegistry,
+		logger:     slog.Default(),
 	}
 
 	for _, option := range options {
@@ -65,7 +112,7 @@ func NewClient(options ...func(*Client)) (*Client, error) {
 
 	if client.apiKey == "" {
 		apiKey, exists := os.LookupEnv("ANTHROPIC_API_KEY")
-		if !exists {
+		if !exists && client.adminKey == "" {
 			return nil, errors.New("ANTHROPIC_API_KEY not found in environment and not provided as option")
 		}
 		client.apiKey = apiKey
@@ -125,12 +172,22 @@ func (c *Client) setRequestHeaders(req *http.Request) {
 
 // createRequest creates and returns a new HTTP request with necessary headers.
 func (c *Client) createRequest(ctx context.Context, payload any, requestType string) (*http.Request, context.CancelFunc, error) {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, nil, err
+	return c.newRequest(ctx, http.MethodPost, requestType, payload)
+}
+
+// newRequest creates a request for the given method and path relative to the base URL.
+// The payload is sent as JSON unless it is nil.
+func (c *Client) newRequest(ctx context.Context, method, path string, payload any) (*http.Request, context.CancelFunc, error) {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewReader(jsonData)
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+requestType, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest(method, c.baseURL+path, body)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -143,6 +200,72 @@ func (c *Client) createRequest(ctx context.Context, payload any, requestType str
 	return req, cancel, nil
 }
 
+// requestOption modifies a request before it is sent.
+type requestOption func(*http.Request)
+
+// withBeta is a request option to enable a beta feature of the API.
+func withBeta(beta string) requestOption {
+	return func(req *http.Request) {
+		addBeta(req, beta)
+	}
+}
+
+// addBeta adds a beta to the anthropic-beta header of the request, keeping the ones already
+// set, e.g. through WithCustomHeaders.
+func addBeta(req *http.Request, beta string) {
+	existing := req.Header.Get("anthropic-beta")
+	if existing == "" {
+		req.Header.Set("anthropic-beta", beta)
+		return
+	}
+	for _, b := range strings.Split(existing, ",") {
+		if strings.TrimSpace(b) == beta {
+			return
+		}
+	}
+	req.Header.Set("anthropic-beta", existing+","+beta)
+}
+
+// doJSON sends a request and decodes the JSON response into out, unless out is nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, payload, out any, opts ...requestOption) error {
+	req, cancel, err := c.newRequest(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	res, err := c.doRequestWithRetries(req)
+	if err != nil {
+		return err
+	}
+
+	return decodeJSONResponse(res, out)
+}
+
+// decodeJSONResponse closes the response after decoding it into out, unless out is nil, or
+// turning it into an *APIError when it is not successful.
+func decodeJSONResponse(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return newAPIError(res, body)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
 // doRequest sends an HTTP request and returns the response.
 func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 	res, err := c.httpClient.Do(req)
@@ -156,6 +279,15 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 // doRequestWithRetries sends the HTTP request and retries upon failure up to the maximum retry limit.
 func (c *Client) doRequestWithRetries(req *http.Request) (*http.Response, error) {
 	for i := 0; i < c.maxRetries; i++ {
+		// the body was consumed by the previous attempt
+		if i > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
 		response, err := c.doRequest(req)
 		if err != nil {
 			if i == c.maxRetries-1 {
@@ -3,8 +3,8 @@ package anthrogo
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
+	"iter"
 	"net/http"
 )
 
@@ -53,33 +53,85 @@ type StreamingCompletionResponse struct {
 	decoder *CompletionSSEDecoder
 	body    io.ReadCloser
 	cancel  context.CancelFunc
+	err     error
 }
 
 // Decode is a method for CompleteStreamResponse that returns the next event
 // from the server-sent events decoder, or an error if one occurred.
-func (c StreamingCompletionResponse) Decode() (*CompletionEvent, error) {
+func (c *StreamingCompletionResponse) Decode() (*CompletionEvent, error) {
 	return c.decoder.Decode()
 }
 
 // Cancel is a method for CompleteStreamResponse that invokes the associated
 // cancel function to stop the request prematurely.
-func (c StreamingCompletionResponse) Cancel() {
+func (c *StreamingCompletionResponse) Cancel() {
 	c.cancel()
 }
 
 // Close is a method for CompleteStreamResponse that closes the response body.
 // If the response body has been read, Close returns nil. Otherwise, it returns
 // an error.
-func (c StreamingCompletionResponse) Close() error {
+func (c *StreamingCompletionResponse) Close() error {
 	return c.body.Close()
 }
 
+// Events returns an iterator over the events of the stream, for use with range. Unlike
+// Decode it skips the lines that do not complete an event and ends at the end of the stream
+// instead of returning io.EOF. Other errors are yielded last, with a nil event. The request
+// is canceled and the body closed when the loop ends, including when it is left early with
+// break.
+func (c *StreamingCompletionResponse) Events() iter.Seq2[*CompletionEvent, error] {
+	return func(yield func(*CompletionEvent, error) bool) {
+		defer c.cancel()
+		defer c.body.Close()
+
+		for {
+			event, err := c.decoder.Decode()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				c.err = err
+				yield(nil, err)
+				return
+			}
+			if event != nil && !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Text returns an iterator over the completion text of the stream. The request is canceled
+// and the body closed when the loop ends; Err reports whether it ended because of an error.
+func (c *StreamingCompletionResponse) Text() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for event, err := range c.Events() {
+			if err != nil {
+				return
+			}
+			if event.Data != nil && event.Data.Completion != "" && !yield(event.Data.Completion) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped Events or Text, if any.
+func (c *StreamingCompletionResponse) Err() error {
+	return c.err
+}
+
 // CompletionRequest sends a complete request to the server and returns the response or error.
 func (c *Client) CompletionRequest(ctx context.Context, payload CompletionPayload) (CompletionResponse, error) {
 	// force stream off if user uses this method
 	payload.Stream = false
 
 	var resp CompletionResponse
+	if err := c.checkCompletionModel(payload.Model); err != nil {
+		return resp, err
+	}
+
 	req, cancel, err := c.createRequest(ctx, payload, RequestTypeComplete)
 	if err != nil {
 		return resp, err
@@ -98,12 +150,7 @@ func (c *Client) CompletionRequest(ctx context.Context, payload CompletionPayloa
 	}
 
 	if res.StatusCode != http.StatusOK {
-		var errorResponse ErrorResponse
-		err = json.Unmarshal(body, &errorResponse)
-		if err != nil {
-			return resp, err
-		}
-		return resp, fmt.Errorf("%s: %s", errorResponse.Error.Type, errorResponse.Error.Message)
+		return resp, newAPIError(res, body)
 	}
 
 	err = json.Unmarshal(body, &resp)
@@ -122,6 +169,10 @@ func (c *Client) StreamingCompletionRequest(ctx context.Context, payload Complet
 	// force stream to true if user calls this method
 	payload.Stream = true
 
+	if err := c.checkCompletionModel(payload.Model); err != nil {
+		return nil, err
+	}
+
 	req, cancel, err := c.createRequest(ctx, payload, RequestTypeComplete)
 	if err != nil {
 		return nil, err
@@ -129,22 +180,21 @@ func (c *Client) StreamingCompletionRequest(ctx context.Context, payload Complet
 
 	res, err := c.doRequestWithRetries(req)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		defer cancel()
+
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
 			return nil, err
 		}
 
-		var errorResponse ErrorResponse
-		err = json.Unmarshal(body, &errorResponse)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("%s: %s", errorResponse.Error.Type, errorResponse.Error.Message)
+		return nil, newAPIError(res, body)
 	}
 
-	return &StreamingCompletionResponse{NewCompletionSSEDecoder(res.Body), res.Body, cancel}, nil
+	return &StreamingCompletionResponse{decoder: NewCompletionSSEDecoder(res.Body), body: res.Body, cancel: cancel}, nil
 }
@@ -170,3 +170,84 @@ func TestCompleteStream_HttpClientError(t *testing.T) {
 
 	mockHTTPClient.AssertExpectations(t)
 }
+
+// trackingBody records whether it was closed.
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func newCompletionStream(t *testing.T, body io.Reader) (*StreamingCompletionResponse, *trackingBody) {
+	tracked := &trackingBody{Reader: body}
+	mockHTTPClient := new(mocks.MockHttpClient)
+	mockHTTPClient.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: tracked}, nil)
+
+	client, err := NewClient(WithApiKey("blah"))
+	require.NoError(t, err)
+	client.httpClient = mockHTTPClient
+
+	response, err := client.StreamingCompletionRequest(context.Background(), CompletionPayload{})
+	require.NoError(t, err)
+	return response, tracked
+}
+
+const completionStream = "event: completion\ndata: {\"completion\":\"Hello\",\"stop_reason\":null,\"model\":\"claude-2.1\"}\n\r\n" +
+	"event: ping\ndata: {}\n\r\n" +
+	"event: completion\ndata: {\"completion\":\" world\",\"stop_reason\":\"stop_sequence\",\"model\":\"claude-2.1\"}\n\r\n"
+
+func TestCompleteStream_Events(t *testing.T) {
+	response, body := newCompletionStream(t, strings.NewReader(completionStream))
+
+	var events []string
+	for event, err := range response.Events() {
+		require.NoError(t, err)
+		events = append(events, event.Event)
+	}
+	assert.Equal(t, []string{"completion", "ping", "completion"}, events)
+	assert.NoError(t, response.Err())
+	assert.True(t, body.closed)
+
+	// breaking out of the loop releases the request
+	response, body = newCompletionStream(t, strings.NewReader(completionStream))
+	for event := range response.Events() {
+		assert.Equal(t, "Hello", event.Data.Completion)
+		break
+	}
+	assert.True(t, body.closed)
+}
+
+func TestCompleteStream_LFSeparatedEvents(t *testing.T) {
+	stream := strings.ReplaceAll(completionStream, "\n\r\n", "\n\n")
+	response, _ := newCompletionStream(t, strings.NewReader(stream))
+
+	var text strings.Builder
+	for chunk := range response.Text() {
+		text.WriteString(chunk)
+	}
+	assert.NoError(t, response.Err())
+	assert.Equal(t, "Hello world", text.String())
+}
+
+func TestCompleteStream_Text(t *testing.T) {
+	response, body := newCompletionStream(t, strings.NewReader(completionStream))
+
+	var text strings.Builder
+	for chunk := range response.Text() {
+		text.WriteString(chunk)
+	}
+	assert.Equal(t, "Hello world", text.String())
+	assert.NoError(t, response.Err())
+	assert.True(t, body.closed)
+
+	response, body = newCompletionStream(t, strings.NewReader("data: {not json}\n\r\n"))
+	for range response.Text() {
+		t.Fatal("unexpected text")
+	}
+	assert.EqualError(t, response.Err(), "error decoding data field: invalid character 'n' looking for beginning of object key string")
+	assert.True(t, body.closed)
+}
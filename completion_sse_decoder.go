@@ -41,15 +41,16 @@ func NewCompletionSSEDecoder(r io.Reader) *CompletionSSEDecoder {
 
 // Decode reads from the buffered reader line by line, parses Server-Sent Events and sets fields on the current event.
 // It returns the complete event when encountering an empty line, and nil otherwise. It will return EOF when nothing is left.
+// Lines may end with "\n" or "\r\n".
 func (d *CompletionSSEDecoder) Decode() (*CompletionEvent, error) {
 	line, err := d.Reader.ReadString('\n')
 	if err != nil {
 		return nil, err
 	}
 
-	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
 
-	if line == "\r" {
+	if line == "" {
 		if d.currentEvent.Event == "" && d.currentEvent.Data == nil && d.currentEvent.ID == "" && d.currentEvent.Retry == 0 {
 			return nil, nil
 		}
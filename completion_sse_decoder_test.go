@@ -32,6 +32,12 @@ func TestDecode(t *testing.T) {
 			wantErr: false,
 			wantEv:  nil,
 		},
+		{
+			name:    "event ended by an empty line",
+			input:   "event: testEvent\n",
+			wantErr: false,
+			wantEv:  &CompletionEvent{Event: "testEvent"},
+		},
 		{
 			name:    "invalid field",
 			input:   "some junk data\n",
@@ -0,0 +1,192 @@
+package anthrogo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Document source types.
+const (
+	DocumentSourceBase64  = "base64"
+	DocumentSourceText    = "text"
+	DocumentSourceContent = "content"
+	DocumentSourceFile    = "file"
+	DocumentSourceURL     = "url"
+)
+
+// Citation location types.
+const (
+	CitationCharLocation         = "char_location"
+	CitationPageLocation         = "page_location"
+	CitationContentBlockLocation = "content_block_location"
+)
+
+// DocumentSource is the source of a document block: a base64 encoded PDF, plain text, a
+// list of custom content chunks, a PDF served at a URL or a file uploaded through the
+// Files API.
+type DocumentSource struct {
+	Type      string           `json:"type"`
+	MediaType string           `json:"media_type,omitempty"`
+	Data      string           `json:"data,omitempty"`
+	Content   []MessageContent `json:"content,omitempty"`
+	URL       string           `json:"url,omitempty"`
+	FileID    string           `json:"file_id,omitempty"`
+}
+
+// CitationsConfig enables citations for a document.
+type CitationsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Citation points to the part of a document that backs a text block. Character locations
+// are used for plain text documents, page locations for PDFs and content block locations
+// for custom content documents. End indices are exclusive.
+type Citation struct {
+	Type           string `json:"type"`
+	CitedText      string `json:"cited_text"`
+	DocumentIndex  int    `json:"document_index"`
+	DocumentTitle  string `json:"document_title,omitempty"`
+	StartCharIndex int    `json:"start_char_index,omitempty"`
+	EndCharIndex   int    `json:"end_char_index,omitempty"`
+	// Page numbers start at 1.
+	StartPageNumber int `json:"start_page_number,omitempty"`
+	EndPageNumber   int `json:"end_page_number,omitempty"`
+	StartBlockIndex int `json:"start_block_index,omitempty"`
+	EndBlockIndex   int `json:"end_block_index,omitempty"`
+}
+
+// NewPDFDocumentSource returns a source holding the given PDF.
+func NewPDFDocumentSource(pdf []byte) *DocumentSource {
+	return &DocumentSource{
+		Type:      DocumentSourceBase64,
+		MediaType: "application/pdf",
+		Data:      base64.StdEncoding.EncodeToString(pdf),
+	}
+}
+
+// NewTextDocumentSource returns a source holding a plain text document.
+func NewTextDocumentSource(text string) *DocumentSource {
+	return &DocumentSource{Type: DocumentSourceText, MediaType: "text/plain", Data: text}
+}
+
+// NewContentDocumentSource returns a source made of custom content chunks. Each chunk is
+// cited as a whole.
+func NewContentDocumentSource(chunks ...MessageContent) *DocumentSource {
+	return &DocumentSource{Type: DocumentSourceContent, Content: chunks}
+}
+
+// NewFileDocumentSource returns a source referring to a file uploaded through the Files API.
+func NewFileDocumentSource(fileID string) *DocumentSource {
+	return &DocumentSource{Type: DocumentSourceFile, FileID: fileID}
+}
+
+// NewURLDocumentSource returns a source referring to a PDF the API downloads from url.
+func NewURLDocumentSource(url string) *DocumentSource {
+	return &DocumentSource{Type: DocumentSourceURL, URL: url}
+}
+
+// NewDocumentContent returns a document block. When citations is true the model cites
+// the passages of the document that back its answer.
+func NewDocumentContent(source *DocumentSource, title string, citations bool) MessageContent {
+	content := MessageContent{Type: ContentTypeDocument, Document: source, Title: title}
+	if citations {
+		content.Citations = &CitationsConfig{Enabled: true}
+	}
+	return content
+}
+
+// validateSources checks the sources of the image and document blocks of the payload,
+// including the ones nested in tool results.
+func (p MessagePayload) validateSources() error {
+	for i, message := range p.Messages {
+		for j, content := range message.Content {
+			if err := content.validateSource(); err != nil {
+				return fmt.Errorf("message %d block %d: %w", i, j, err)
+			}
+			for k, nested := range content.Content {
+				if err := nested.validateSource(); err != nil {
+					return fmt.Errorf("message %d block %d content %d: %w", i, j, k, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSource checks the source of an image or document block.
+func (c MessageContent) validateSource() error {
+	switch c.Type {
+	case ContentTypeImage:
+		return c.Image.validate()
+	case ContentTypeDocument:
+		return c.Document.validate()
+	default:
+		return nil
+	}
+}
+
+// validate checks that the fields set on the source match its type.
+func (s *DocumentSource) validate() error {
+	if s == nil {
+		return errors.New("document has no source")
+	}
+
+	switch s.Type {
+	case DocumentSourceBase64:
+		if s.MediaType != "application/pdf" {
+			return fmt.Errorf("base64 document must have media type application/pdf, got %q", s.MediaType)
+		}
+		if s.Data == "" {
+			return errors.New("base64 document has no data")
+		}
+	case DocumentSourceText:
+		if s.MediaType != "text/plain" {
+			return fmt.Errorf("text document must have media type text/plain, got %q", s.MediaType)
+		}
+	case DocumentSourceContent:
+		if len(s.Content) == 0 {
+			return errors.New("content document has no content")
+		}
+	case DocumentSourceURL:
+		if err := validateSourceURL(s.URL); err != nil {
+			return fmt.Errorf("url document: %w", err)
+		}
+		if s.MediaType != "" || s.Data != "" || len(s.Content) > 0 || s.FileID != "" {
+			return errors.New("url document may only have a url")
+		}
+		return nil
+	case DocumentSourceFile:
+		if s.FileID == "" {
+			return errors.New("file document has no file_id")
+		}
+		if s.MediaType != "" || s.Data != "" || len(s.Content) > 0 || s.URL != "" {
+			return errors.New("file document may only have a file_id")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown document source type %q", s.Type)
+	}
+
+	if s.URL != "" || s.FileID != "" {
+		return fmt.Errorf("%s document may not have a url or file_id", s.Type)
+	}
+
+	return nil
+}
+
+// validateSourceURL checks that a source URL is an absolute http or https URL.
+func validateSourceURL(raw string) error {
+	if raw == "" {
+		return errors.New("missing url")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be absolute http or https, got %q", raw)
+	}
+	return nil
+}
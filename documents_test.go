@@ -0,0 +1,189 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageContent_MarshalDocument(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  MessageContent
+		expected string
+	}{
+		{
+			name:     "pdf",
+			content:  NewDocumentContent(NewPDFDocumentSource([]byte("%PDF")), "Contract", true),
+			expected: `{"type": "document", "title": "Contract", "citations": {"enabled": true}, "source": {"type": "base64", "media_type": "application/pdf", "data": "JVBERg=="}}`,
+		},
+		{
+			name:     "plain text",
+			content:  NewDocumentContent(NewTextDocumentSource("The grass is green."), "", false),
+			expected: `{"type": "document", "source": {"type": "text", "media_type": "text/plain", "data": "The grass is green."}}`,
+		},
+		{
+			name:     "custom content",
+			content:  NewDocumentContent(NewContentDocumentSource(NewTextContent("chunk one"), NewTextContent("chunk two")), "", true),
+			expected: `{"type": "document", "citations": {"enabled": true}, "source": {"type": "content", "content": [{"type": "text", "text": "chunk one"}, {"type": "text", "text": "chunk two"}]}}`,
+		},
+		{
+			name:     "file",
+			content:  MessageContent{Type: ContentTypeDocument, Document: NewFileDocumentSource("file_1"), Context: "Signed in 2021"},
+			expected: `{"type": "document", "context": "Signed in 2021", "source": {"type": "file", "file_id": "file_1"}}`,
+		},
+		{
+			name:     "image",
+			content:  MessageContent{Type: ContentTypeImage, Image: &ImageSource{Type: "base64", MediaType: "image/png", Data: "abc"}},
+			expected: `{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "abc"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.content)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(data))
+
+			var decoded MessageContent
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, tc.content, decoded)
+		})
+	}
+}
+
+func TestMessageContent_UnmarshalStringToolResult(t *testing.T) {
+	var content MessageContent
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "tool_result", "tool_use_id": "t", "content": "42"}`), &content))
+	assert.Equal(t, NewToolResultContent("t", NewTextContent("42")), content)
+}
+
+func TestMessagePayload_ValidateDocuments(t *testing.T) {
+	testCases := []struct {
+		name          string
+		content       MessageContent
+		expectedError string
+	}{
+		{
+			name:    "valid",
+			content: NewDocumentContent(NewTextDocumentSource("text"), "", true),
+		},
+		{
+			name:          "missing source",
+			content:       MessageContent{Type: ContentTypeDocument},
+			expectedError: "message 0 block 0: document has no source",
+		},
+		{
+			name:          "wrong media type",
+			content:       NewDocumentContent(&DocumentSource{Type: DocumentSourceBase64, MediaType: "image/png", Data: "x"}, "", false),
+			expectedError: `message 0 block 0: base64 document must have media type application/pdf, got "image/png"`,
+		},
+		{
+			name:          "empty content",
+			content:       NewDocumentContent(NewContentDocumentSource(), "", false),
+			expectedError: "message 0 block 0: content document has no content",
+		},
+		{
+			name:          "missing file id",
+			content:       NewDocumentContent(NewFileDocumentSource(""), "", false),
+			expectedError: "message 0 block 0: file document has no file_id",
+		},
+		{
+			name:    "url",
+			content: NewDocumentContent(NewURLDocumentSource("https://example.com/report.pdf"), "", true),
+		},
+		{
+			name:          "relative url",
+			content:       NewDocumentContent(NewURLDocumentSource("/report.pdf"), "", false),
+			expectedError: `message 0 block 0: url document: url must be absolute http or https, got "/report.pdf"`,
+		},
+		{
+			name:          "url with data",
+			content:       NewDocumentContent(&DocumentSource{Type: DocumentSourceURL, URL: "https://example.com/a.pdf", MediaType: "application/pdf", Data: "x"}, "", false),
+			expectedError: "message 0 block 0: url document may only have a url",
+		},
+		{
+			name:          "file with url",
+			content:       NewDocumentContent(&DocumentSource{Type: DocumentSourceFile, FileID: "file_1", URL: "https://example.com/a.pdf"}, "", false),
+			expectedError: "message 0 block 0: file document may only have a file_id",
+		},
+		{
+			name:          "text with file id",
+			content:       NewDocumentContent(&DocumentSource{Type: DocumentSourceText, MediaType: "text/plain", Data: "x", FileID: "file_1"}, "", false),
+			expectedError: "message 0 block 0: text document may not have a url or file_id",
+		},
+		{
+			name:          "unknown type",
+			content:       NewDocumentContent(&DocumentSource{Type: "ftp"}, "", false),
+			expectedError: `message 0 block 0: unknown document source type "ftp"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := MessagePayload{Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{tc.content}}}}
+			err := payload.validate()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMessageResponse_Citations(t *testing.T) {
+	var resp MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(`{"content": [
+		{"type": "text", "text": "The grass is green.", "citations": [
+			{"type": "char_location", "cited_text": "The grass is green.", "document_index": 0, "document_title": "Facts", "start_char_index": 0, "end_char_index": 19}
+		]},
+		{"type": "text", "text": "The sky is blue.", "citations": [
+			{"type": "page_location", "cited_text": "The sky is blue.", "document_index": 1, "start_page_number": 2, "end_page_number": 3},
+			{"type": "content_block_location", "cited_text": "blue", "document_index": 2, "start_block_index": 1, "end_block_index": 2}
+		]}
+	]}`), &resp))
+
+	require.Len(t, resp.Content, 2)
+	assert.Equal(t, []Citation{{
+		Type:           CitationCharLocation,
+		CitedText:      "The grass is green.",
+		DocumentTitle:  "Facts",
+		StartCharIndex: 0,
+		EndCharIndex:   19,
+	}}, resp.Content[0].Citations)
+	assert.Equal(t, 2, resp.Content[1].Citations[0].StartPageNumber)
+	assert.Equal(t, CitationContentBlockLocation, resp.Content[1].Citations[1].Type)
+	assert.Equal(t, 2, resp.Content[1].Citations[1].EndBlockIndex)
+}
+
+func TestMessageSSEDecoder_CitationsDelta(t *testing.T) {
+	input := `event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": "", "citations": []}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "citations_delta", "citation": {"type": "char_location", "cited_text": "green", "document_index": 0, "start_char_index": 13, "end_char_index": 18}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "It is green."}}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	_, err := decoder.Decode()
+	require.NoError(t, err)
+
+	event, err := decoder.Decode()
+	require.NoError(t, err)
+	assert.Empty(t, event.Data.Content)
+	require.NotNil(t, event.Data.Citation)
+	assert.Equal(t, Citation{Type: CitationCharLocation, CitedText: "green", StartCharIndex: 13, EndCharIndex: 18}, *event.Data.Citation)
+
+	event, err = decoder.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "It is green.", event.Data.Content)
+	assert.Nil(t, event.Data.Citation)
+}
@@ -0,0 +1,341 @@
+package anthrogo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultCharsPerToken is the average number of characters per token of English prose
+	// and code.
+	DefaultCharsPerToken = 3.5
+
+	// textErrorMargin is the relative error of the text heuristic for English prose and
+	// code before calibration.
+	textErrorMargin = 0.15
+
+	// imagePixelsPerToken follows the documented width * height / 750 formula.
+	imagePixelsPerToken = 750
+	// maxImageTokens is the cost of an image at the size the API scales images down to.
+	maxImageTokens = 1600
+	// maxImagePixels is the area above which the API scales images down.
+	maxImagePixels = 1_150_000
+
+	// pdfPageTokens is the typical cost of a PDF page: its extracted text plus the page
+	// rendered as an image. Pages range from about 1,500 to 3,000 tokens.
+	pdfPageTokens  = 2250
+	pdfErrorMargin = 0.35
+
+	// messageOverheadTokens and blockOverheadTokens account for the role and block markers.
+	messageOverheadTokens = 4
+	blockOverheadTokens   = 3
+	// requestOverheadTokens is added once per request.
+	requestOverheadTokens = 7
+	// toolSystemPromptTokens is the system prompt added by the API when tools are provided.
+	toolSystemPromptTokens = 346
+	// toolOverheadTokens is added per tool definition on top of its JSON.
+	toolOverheadTokens = 10
+
+	// calibrationWeight is the weight of a new observation in the running scale.
+	calibrationWeight = 0.3
+)
+
+var pdfPagePattern = regexp.MustCompile(`/Type\s*/Page\b`)
+
+// defaultTokenEstimator is used by EstimateTokens and the automatic cache strategy. It is
+// never calibrated.
+var defaultTokenEstimator = NewTokenEstimator()
+
+// EstimateTokens estimates the input tokens of a payload without calling the API, using an
+// uncalibrated TokenEstimator. See TokenEstimator for its error bounds.
+func EstimateTokens(payload MessagePayload) int {
+	return defaultTokenEstimator.Estimate(payload)
+}
+
+// TokenEstimate is an estimate along with the range the actual count is expected to fall in.
+type TokenEstimate struct {
+	Tokens int
+	Low    int
+	High   int
+}
+
+// TokenEstimator estimates the input tokens of payloads offline, with heuristics per content
+// type:
+//
+//   - text, tool definitions and tool inputs: characters divided by CharsPerToken, with
+//     characters of CJK scripts counted as one token each;
+//   - base64 images: width * height / 750 after the API's own downscaling, at most 1,600;
+//   - images sent by URL or file ID: 1,600, since their size is unknown;
+//   - base64 PDFs: 2,250 per page;
+//   - PDFs sent by URL or file ID: a single page;
+//   - thinking blocks: nothing, the API ignores those of previous turns.
+//
+// Uncalibrated, estimates of English prose and code are typically within 15% of the count
+// endpoint, images within 10% and PDFs within 35%. Other languages and content sent by
+// reference can be off by a factor of two; EstimateRange accounts for all of these. Calibrate
+// with the Usage of real requests to bring text estimates closer to the traffic at hand.
+//
+// A TokenEstimator is safe for concurrent use.
+type TokenEstimator struct {
+	// CharsPerToken is the average number of characters per token of text.
+	CharsPerToken float64
+
+	mu sync.Mutex
+	// scale corrects text estimates and is learned by Calibrate.
+	scale float64
+}
+
+// NewTokenEstimator returns an uncalibrated estimator.
+func NewTokenEstimator() *TokenEstimator {
+	return &TokenEstimator{CharsPerToken: DefaultCharsPerToken, scale: 1}
+}
+
+// Estimate returns the estimated input tokens of the payload.
+func (e *TokenEstimator) Estimate(payload MessagePayload) int {
+	return e.EstimateRange(payload).Tokens
+}
+
+// EstimateRange returns the estimated input tokens of the payload and the range the actual
+// count is expected to fall in. Leaving headroom up to High is safe in almost all cases.
+func (e *TokenEstimator) EstimateRange(payload MessagePayload) TokenEstimate {
+	t := e.payload(payload)
+	scale := e.Scale()
+
+	text := t.text * scale
+	tokens := text + t.fixed
+	spread := text*textErrorMargin + t.spread
+
+	return TokenEstimate{
+		Tokens: int(math.Round(tokens)),
+		Low:    max(0, int(math.Floor(tokens-spread))),
+		High:   int(math.Ceil(tokens + spread)),
+	}
+}
+
+// EstimateContent returns the estimated tokens of a single block, e.g. to size the chunks
+// of a document.
+func (e *TokenEstimator) EstimateContent(content MessageContent) int {
+	t := e.content(content)
+	return int(math.Round(t.text*e.Scale() + t.fixed))
+}
+
+// EstimateText returns the estimated tokens of a text.
+func (e *TokenEstimator) EstimateText(text string) int {
+	return int(math.Round(e.text(text) * e.Scale()))
+}
+
+// Calibrate adjusts the estimator with the Usage reported for a payload. The text estimates
+// are scaled so that the estimate of the payload moves towards the reported input tokens,
+// cached ones included. Each call moves the scale by a fraction of the observed error, so
+// a few representative requests are enough and outliers have a limited effect.
+func (e *TokenEstimator) Calibrate(payload MessagePayload, usage Usage) {
+	actual := float64(usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens)
+	t := e.payload(payload)
+	if actual <= 0 || t.text <= 0 {
+		return
+	}
+
+	observed := (actual - t.fixed) / t.text
+	// a ratio this far off comes from content the heuristics do not cover, not from text
+	observed = math.Max(0.5, math.Min(2, observed))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scale += calibrationWeight * (observed - e.scale)
+}
+
+// Scale returns the correction applied to text estimates, 1 until Calibrate is called.
+func (e *TokenEstimator) Scale() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.scale
+}
+
+// tokenTally accumulates estimated tokens. Text tokens are kept apart since they are scaled
+// by calibration; spread is the absolute uncertainty of the fixed tokens.
+type tokenTally struct {
+	text   float64
+	fixed  float64
+	spread float64
+}
+
+func (t *tokenTally) add(other tokenTally) {
+	t.text += other.text
+	t.fixed += other.fixed
+	t.spread += other.spread
+}
+
+// total returns the tokens of the tally with the text scaled.
+func (t tokenTally) total(scale float64) int {
+	return int(math.Round(t.text*scale + t.fixed))
+}
+
+func (e *TokenEstimator) payload(payload MessagePayload) tokenTally {
+	t := tokenTally{fixed: requestOverheadTokens}
+
+	t.add(e.tools(payload.Tools))
+	if payload.System != nil {
+		t.text += e.text(*payload.System)
+	}
+	t.add(e.blocks(payload.SystemBlocks))
+	for _, message := range payload.Messages {
+		t.add(e.message(message))
+	}
+
+	return t
+}
+
+func (e *TokenEstimator) tools(tools []Tool) tokenTally {
+	var t tokenTally
+	if len(tools) == 0 {
+		return t
+	}
+
+	t.fixed += toolSystemPromptTokens
+	for _, tool := range tools {
+		t.fixed += toolOverheadTokens
+		t.text += e.text(tool.Name) + e.text(tool.Description) + e.json(tool.InputSchema)
+	}
+	return t
+}
+
+func (e *TokenEstimator) message(message Message) tokenTally {
+	t := tokenTally{fixed: messageOverheadTokens}
+	t.add(e.blocks(message.Content))
+	return t
+}
+
+func (e *TokenEstimator) blocks(blocks []MessageContent) tokenTally {
+	var t tokenTally
+	for _, block := range blocks {
+		t.add(e.content(block))
+	}
+	return t
+}
+
+func (e *TokenEstimator) content(content MessageContent) tokenTally {
+	t := tokenTally{fixed: blockOverheadTokens}
+
+	switch content.Type {
+	case ContentTypeText:
+		if content.Text != nil {
+			t.text += e.text(*content.Text)
+		}
+	case ContentTypeImage:
+		tokens, margin := imageTokens(content.Image)
+		t.fixed += tokens
+		t.spread += tokens * margin
+	case ContentTypeDocument:
+		t.text += e.text(content.Title) + e.text(content.Context)
+		t.add(e.document(content.Document))
+	case ContentTypeToolUse:
+		t.text += e.text(content.Name) + e.text(string(content.Input))
+	case ContentTypeToolResult:
+		t.add(e.blocks(content.Content))
+	case ContentTypeThinking, ContentTypeRedactedThinking:
+		t.fixed = 0
+	}
+
+	return t
+}
+
+func (e *TokenEstimator) document(source *DocumentSource) tokenTally {
+	var t tokenTally
+	if source == nil {
+		return t
+	}
+
+	switch source.Type {
+	case DocumentSourceText:
+		t.text += e.text(source.Data)
+	case DocumentSourceContent:
+		t.add(e.blocks(source.Content))
+	case DocumentSourceBase64:
+		pages, ok := pdfPages(source.Data)
+		margin := pdfErrorMargin
+		if !ok {
+			pages, margin = 1, 1
+		}
+		t.fixed += float64(pages * pdfPageTokens)
+		t.spread += float64(pages*pdfPageTokens) * margin
+	default:
+		// the content of URL and file documents is unknown
+		t.fixed += pdfPageTokens
+		t.spread += pdfPageTokens
+	}
+
+	return t
+}
+
+// text returns the unscaled tokens of a text.
+func (e *TokenEstimator) text(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	var other, cjk int
+	for _, r := range s {
+		if r >= 0x2E80 {
+			cjk++
+		} else {
+			other++
+		}
+	}
+
+	charsPerToken := e.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = DefaultCharsPerToken
+	}
+	return float64(other)/charsPerToken + float64(cjk)
+}
+
+// json returns the unscaled tokens of the JSON encoding of v.
+func (e *TokenEstimator) json(v any) float64 {
+	if v == nil {
+		return 0
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return e.text(string(data))
+}
+
+// imageTokens returns the tokens of an image and the relative error of the estimate.
+func imageTokens(source *ImageSource) (float64, float64) {
+	if source == nil || source.Type != ImageSourceBase64 {
+		return maxImageTokens, 1
+	}
+
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(source.Data)))
+	if err != nil {
+		// WebP or an unreadable image
+		return maxImageTokens, 1
+	}
+
+	width, height := float64(config.Width), float64(config.Height)
+	scale := math.Min(1, float64(RecommendedImageLongEdge)/math.Max(width, height))
+	scale = math.Min(scale, math.Sqrt(maxImagePixels/(width*height)))
+
+	tokens := math.Ceil(width * scale * height * scale / imagePixelsPerToken)
+	return math.Min(tokens, maxImageTokens), 0.1
+}
+
+// pdfPages counts the pages of a base64 encoded PDF from its page objects.
+func pdfPages(data string) (int, bool) {
+	pdf, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return 0, false
+	}
+
+	pages := len(pdfPagePattern.FindAllIndex(pdf, -1))
+	if pages == 0 {
+		return 0, false
+	}
+	return pages, true
+}
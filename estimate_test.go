@@ -0,0 +1,151 @@
+package anthrogo
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenEstimator_EstimateText(t *testing.T) {
+	estimator := NewTokenEstimator()
+
+	assert.Equal(t, 0, estimator.EstimateText(""))
+	assert.Equal(t, 3, estimator.EstimateText("hello world"))
+	assert.Equal(t, 1000, estimator.EstimateText(strings.Repeat("x", 3500)))
+	assert.Equal(t, 3, estimator.EstimateText("日本語"))
+}
+
+func TestTokenEstimator_EstimateContent(t *testing.T) {
+	estimator := NewTokenEstimator()
+	thinking := "long reasoning"
+
+	pdf := "%PDF-1.7\n1 0 obj << /Type /Pages /Count 3 >>\n" + strings.Repeat("2 0 obj << /Type /Page /Parent 1 0 R >>\n", 3)
+
+	testCases := []struct {
+		name     string
+		content  MessageContent
+		expected int
+	}{
+		{
+			name:     "text",
+			content:  NewTextContent(strings.Repeat("x", 35)),
+			expected: 3 + 10,
+		},
+		{
+			name:     "small image",
+			content:  NewImageContent(NewBase64ImageSource("image/png", encodePNG(t, testImage(100, 75)))),
+			expected: 3 + 10,
+		},
+		{
+			name:     "large image is scaled down",
+			content:  NewImageContent(NewBase64ImageSource("image/png", encodePNG(t, testImage(3000, 2000)))),
+			expected: 3 + 1534,
+		},
+		{
+			name:     "url image",
+			content:  NewImageContent(NewURLImageSource("https://cdn.example.com/cat.jpg")),
+			expected: 3 + 1600,
+		},
+		{
+			name:     "pdf",
+			content:  NewDocumentContent(NewPDFDocumentSource([]byte(pdf)), "", false),
+			expected: 3 + 3*2250,
+		},
+		{
+			name:     "text document",
+			content:  NewDocumentContent(NewTextDocumentSource(strings.Repeat("x", 70)), strings.Repeat("t", 7), false),
+			expected: 3 + 2 + 20,
+		},
+		{
+			name:     "tool result",
+			content:  NewToolResultContent("t", NewTextContent(strings.Repeat("x", 35))),
+			expected: 3 + 3 + 10,
+		},
+		{
+			name:     "thinking",
+			content:  MessageContent{Type: ContentTypeThinking, Thinking: &thinking, Signature: "sig"},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, estimator.EstimateContent(tc.content))
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	system := strings.Repeat("s", 70)
+	payload := MessagePayload{
+		Model:    ModelClaude3Haiku,
+		System:   &system,
+		Messages: conversation(strings.Repeat("x", 350), strings.Repeat("y", 35)),
+	}
+
+	// request, system, two messages with a block each
+	assert.Equal(t, 7+20+(4+3+100)+(4+3+10), EstimateTokens(payload))
+
+	payload.Tools = []Tool{{Name: "lookup", InputSchema: map[string]any{"type": "object"}}}
+	withTools := EstimateTokens(payload)
+	assert.Greater(t, withTools, 151+346+10)
+	assert.Less(t, withTools, 151+346+10+10)
+}
+
+func TestTokenEstimator_EstimateRange(t *testing.T) {
+	estimator := NewTokenEstimator()
+
+	estimate := estimator.EstimateRange(MessagePayload{Messages: conversation(strings.Repeat("x", 3500))})
+	assert.Equal(t, TokenEstimate{Tokens: 1014, Low: 864, High: 1164}, estimate)
+
+	estimate = estimator.EstimateRange(MessagePayload{Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+		NewImageContent(NewFileImageSource("file_1")),
+	}}}})
+	assert.Equal(t, TokenEstimate{Tokens: 1614, Low: 14, High: 3214}, estimate)
+}
+
+func TestTokenEstimator_Calibrate(t *testing.T) {
+	estimator := NewTokenEstimator()
+	payload := MessagePayload{Messages: conversation(strings.Repeat("x", 3500))}
+	require.Equal(t, 1014, estimator.Estimate(payload))
+
+	// the text actually used twice as many tokens as estimated
+	usage := Usage{InputTokens: 14, CacheReadInputTokens: 2000}
+
+	estimator.Calibrate(payload, usage)
+	assert.InDelta(t, 1.3, estimator.Scale(), 0.0001)
+
+	for i := 0; i < 20; i++ {
+		estimator.Calibrate(payload, usage)
+	}
+	assert.InDelta(t, 2, estimator.Scale(), 0.01)
+	assert.InDelta(t, 2014, estimator.Estimate(payload), 10)
+
+	// outliers are clamped
+	estimator = NewTokenEstimator()
+	estimator.Calibrate(payload, Usage{InputTokens: 1_000_000})
+	assert.InDelta(t, 1.3, estimator.Scale(), 0.0001)
+
+	// payloads without text and empty usage are ignored
+	estimator.Calibrate(MessagePayload{}, Usage{InputTokens: 10})
+	estimator.Calibrate(payload, Usage{})
+	assert.InDelta(t, 1.3, estimator.Scale(), 0.0001)
+
+	// the default estimator is never calibrated
+	assert.Equal(t, 1014, EstimateTokens(payload))
+}
+
+func TestPdfPages(t *testing.T) {
+	_, ok := pdfPages("not base64!")
+	assert.False(t, ok)
+
+	_, ok = pdfPages(base64.StdEncoding.EncodeToString([]byte("%PDF /Type /Pages")))
+	assert.False(t, ok)
+
+	pages, ok := pdfPages(base64.StdEncoding.EncodeToString([]byte("/Type/Page /Type /Page\n")))
+	assert.True(t, ok)
+	assert.Equal(t, 2, pages)
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strings"
@@ -32,7 +31,7 @@ func main() {
 	conversation.AddMessage(anthrogo.RoleHuman, userPrompt)
 
 	// Set up the payload and send completion stream request
-	completeStreamResp, _ := c.StreamingCompletionRequest(context.Background(), anthrogo.CompletionPayload{
+	completeStreamResp, err := c.StreamingCompletionRequest(context.Background(), anthrogo.CompletionPayload{
 		MaxTokensToSample: 256,
 		Model:             anthrogo.ModelClaude2,
 		Prompt:            conversation.GeneratePrompt(),
@@ -41,27 +40,16 @@ func main() {
 			Temperature: 1,
 		},
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Ensure that the request is canceled after timeout (default 1 minute)
-	defer completeStreamResp.Cancel()
-
-	// Ensure that the stream response body is closed when the function returns
-	defer completeStreamResp.Close()
-
-	// Continually read from the response until an error or EOF is encountered
-	for {
-		event, err := completeStreamResp.Decode()
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		}
-
-		if event != nil {
-			fmt.Printf("%s", event.Data.Completion)
-		}
+	// The request is canceled and the body closed when the loop ends
+	for text := range completeStreamResp.Text() {
+		fmt.Print(text)
+	}
+	if err := completeStreamResp.Err(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strings"
@@ -27,7 +26,7 @@ func main() {
 	userPrompt, _ := reader.ReadString('\n')
 	userPrompt = strings.TrimSuffix(userPrompt, "\n")
 
-	r, _, err := c.MessageStreamRequest(context.Background(), anthrogo.MessagePayload{
+	stream, err := c.MessageStreamRequest(context.Background(), anthrogo.MessagePayload{
 		Model: anthrogo.ModelClaude3Dot5Sonnet,
 		Messages: []anthrogo.Message{{
 			Role: anthrogo.RoleTypeUser,
@@ -38,29 +37,17 @@ func main() {
 		}},
 		System:    &systemPrompt,
 		MaxTokens: 1000,
-	})
+	}, anthrogo.DecodeOptions{ContentOnly: true})
 	if err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
-	defer r.Close()
+	defer stream.Close()
 
-	// Create an SSEDecoder
-	decoder := anthrogo.NewMessageSSEDecoder(r)
-	for {
-		message, err := decoder.Decode(anthrogo.DecodeOptions{ContentOnly: true})
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			fmt.Print(err)
-			continue
-		}
-
-		if message.Event == "message_stop" {
-			break
-		}
-
-		fmt.Print(message.Data.Content)
+	for stream.Next() {
+		fmt.Print(stream.Current().Data.Content)
+	}
+	if err := stream.Err(); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,285 @@
+package anthrogo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	RequestTypeFiles = "files"
+
+	// FilesAPIBeta is the beta enabling the Files API. It is sent with the requests of this
+	// file and with message requests referring to uploaded files.
+	FilesAPIBeta = "files-api-2025-04-14"
+)
+
+// FileMetadata describes a file uploaded through the Files API.
+type FileMetadata struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Filename  string    `json:"filename"`
+	MimeType  string    `json:"mime_type"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	// Downloadable is true for files created by the model, such as the output of code
+	// execution. Uploaded files cannot be downloaded.
+	Downloadable bool `json:"downloadable"`
+}
+
+// DocumentContent returns a document block referring to the file.
+func (f FileMetadata) DocumentContent(title string, citations bool) MessageContent {
+	return NewDocumentContent(NewFileDocumentSource(f.ID), title, citations)
+}
+
+// ImageContent returns an image block referring to the file.
+func (f FileMetadata) ImageContent() MessageContent {
+	return NewImageContent(NewFileImageSource(f.ID))
+}
+
+// UploadFile uploads the content of r under the given file name. The media type is guessed
+// from the extension of the name, or from the content, when mediaType is empty. The content
+// is streamed to the API as it is read rather than loaded in memory. Uploads are only
+// retried when r is an io.Seeker that supports seeking, so that it can be read again from
+// the start.
+func (c *Client) UploadFile(ctx context.Context, filename string, r io.Reader, mediaType string) (FileMetadata, error) {
+	var file FileMetadata
+
+	// readers that cannot seek, such as pipes, are sent once without retries
+	start := int64(-1)
+	seeker, _ := r.(io.Seeker)
+	if seeker != nil {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			start = offset
+		}
+	}
+
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if mediaType == "" {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(r, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return file, err
+		}
+		mediaType = http.DetectContentType(head[:n])
+		if start >= 0 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return file, err
+			}
+		} else {
+			r = io.MultiReader(bytes.NewReader(head[:n]), r)
+		}
+	}
+
+	req, cancel, err := c.newRequest(ctx, http.MethodPost, RequestTypeFiles, nil)
+	if err != nil {
+		return file, err
+	}
+	defer cancel()
+	addBeta(req, FilesAPIBeta)
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	body := newMultipartFileBody(boundary, filename, mediaType, r)
+	defer func() { body.Close() }()
+	req.Body = body
+	if start >= 0 {
+		req.GetBody = func() (io.ReadCloser, error) {
+			// wait for the previous attempt to stop reading before rewinding
+			body.Close()
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+			body = newMultipartFileBody(boundary, filename, mediaType, r)
+			return body, nil
+		}
+	}
+
+	var res *http.Response
+	if req.GetBody != nil {
+		res, err = c.doRequestWithRetries(req)
+	} else {
+		res, err = c.doRequest(req)
+	}
+	if err != nil {
+		return file, err
+	}
+
+	err = decodeJSONResponse(res, &file)
+	return file, err
+}
+
+// UploadFileFromPath uploads the file at path under its base name, streaming it from disk.
+func (c *Client) UploadFileFromPath(ctx context.Context, path string, mediaType string) (FileMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	defer f.Close()
+
+	return c.UploadFile(ctx, filepath.Base(path), f, mediaType)
+}
+
+// ListFiles returns a page of the files of the workspace, most recent first.
+func (c *Client) ListFiles(ctx context.Context, opts ListOptions) (Page[FileMetadata], error) {
+	var page Page[FileMetadata]
+	err := c.doJSON(ctx, http.MethodGet, withQuery(RequestTypeFiles, opts.values()), nil, &page, withBeta(FilesAPIBeta))
+	return page, err
+}
+
+// IterateFiles returns an iterator over all the files of the workspace.
+func (c *Client) IterateFiles(ctx context.Context, opts ListOptions) *PageIterator[FileMetadata] {
+	return newPageIterator(ctx, opts, c.ListFiles)
+}
+
+// GetFileMetadata returns the metadata of a file.
+func (c *Client) GetFileMetadata(ctx context.Context, id string) (FileMetadata, error) {
+	var file FileMetadata
+	err := c.doJSON(ctx, http.MethodGet, filePath(id), nil, &file, withBeta(FilesAPIBeta))
+	return file, err
+}
+
+// DownloadFile streams the content of a file created by the model. The returned body must be
+// closed.
+func (c *Client) DownloadFile(ctx context.Context, id string) (io.ReadCloser, error) {
+	req, cancel, err := c.newRequest(ctx, http.MethodGet, filePath(id)+"/content", nil)
+	if err != nil {
+		return nil, err
+	}
+	addBeta(req, FilesAPIBeta)
+	req.Header.Set("Accept", "*/*")
+
+	res, err := c.doRequestWithRetries(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		defer cancel()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, newAPIError(res, body)
+	}
+
+	return &cancelOnClose{ReadCloser: res.Body, cancel: cancel}, nil
+}
+
+// DeleteFile deletes a file. Requests referring to it fail afterwards.
+func (c *Client) DeleteFile(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, filePath(id), nil, nil, withBeta(FilesAPIBeta))
+}
+
+// usesFiles reports whether the payload refers to files uploaded through the Files API, in
+// which case its requests need the Files API beta.
+func (p MessagePayload) usesFiles() bool {
+	uses := func(content MessageContent) bool {
+		return (content.Document != nil && content.Document.Type == DocumentSourceFile) ||
+			(content.Image != nil && content.Image.Type == ImageSourceFile)
+	}
+
+	for _, message := range p.Messages {
+		for _, content := range message.Content {
+			if uses(content) {
+				return true
+			}
+			for _, nested := range content.Content {
+				if uses(nested) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// requestOptions returns the options of the requests sending the payload.
+func (p MessagePayload) requestOptions() []requestOption {
+	if p.usesFiles() {
+		return []requestOption{withBeta(FilesAPIBeta)}
+	}
+	return nil
+}
+
+func filePath(id string) string {
+	return RequestTypeFiles + "/" + url.PathEscape(id)
+}
+
+// multipartFileBody streams a file as the file part of a multipart form. The form is written
+// by a goroutine as the body is read, so the file is never held in memory.
+type multipartFileBody struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func newMultipartFileBody(boundary, filename, mediaType string, r io.Reader) *multipartFileBody {
+	pr, pw := io.Pipe()
+	body := &multipartFileBody{PipeReader: pr, done: make(chan struct{})}
+
+	go func() {
+		defer close(body.done)
+
+		form := multipart.NewWriter(pw)
+		if err := form.SetBoundary(boundary); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(filename)))
+		header.Set("Content-Type", mediaType)
+
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return body
+}
+
+// Close stops the goroutine writing the form and waits for it to return, after which the
+// file is no longer read.
+func (b *multipartFileBody) Close() error {
+	err := b.PipeReader.Close()
+	<-b.done
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// cancelOnClose releases the context of a streamed response when it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,247 @@
+package anthrogo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fileJSON = `{"id": "file_1", "type": "file", "filename": "report.pdf", "mime_type": "application/pdf", "size_bytes": 4, "created_at": "2025-05-01T00:00:00Z", "downloadable": false}`
+
+// uploadServer accepts uploads and records the part it received.
+func uploadServer(t *testing.T, part *map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/files", r.URL.Path)
+		assert.Equal(t, FilesAPIBeta, r.Header.Get("anthropic-beta"))
+
+		reader, err := r.MultipartReader()
+		require.NoError(t, err)
+		p, err := reader.NextPart()
+		require.NoError(t, err)
+		content, err := io.ReadAll(p)
+		require.NoError(t, err)
+
+		*part = map[string]string{
+			"name":         p.FormName(),
+			"filename":     p.FileName(),
+			"content_type": p.Header.Get("Content-Type"),
+			"content":      string(content),
+		}
+
+		_, err = reader.NextPart()
+		assert.Equal(t, io.EOF, err)
+
+		w.Write([]byte(fileJSON))
+	}))
+}
+
+func TestClient_UploadFile(t *testing.T) {
+	var part map[string]string
+	ts := uploadServer(t, &part)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("%PDF"), 0o644))
+
+	file, err := client.UploadFileFromPath(context.Background(), path, "")
+	require.NoError(t, err)
+	assert.Equal(t, "file_1", file.ID)
+	assert.Equal(t, int64(4), file.SizeBytes)
+	assert.Equal(t, map[string]string{
+		"name":         "file",
+		"filename":     "report.pdf",
+		"content_type": "application/pdf",
+		"content":      "%PDF",
+	}, part)
+
+	// the media type is sniffed from the content when the name has no known extension
+	png := encodePNG(t, testImage(2, 2))
+	_, err = client.UploadFile(context.Background(), `chart "final"`, io.MultiReader(bytes.NewReader(png)), "")
+	require.NoError(t, err)
+	assert.Equal(t, `chart "final"`, part["filename"])
+	assert.Equal(t, "image/png", part["content_type"])
+	assert.Equal(t, string(png), part["content"])
+
+	_, err = client.UploadFile(context.Background(), "notes", strings.NewReader("hello"), "text/markdown")
+	require.NoError(t, err)
+	assert.Equal(t, "text/markdown", part["content_type"])
+	assert.Equal(t, "hello", part["content"])
+}
+
+// unseekableReader is an io.Seeker that cannot seek, like an *os.File reading a pipe.
+type unseekableReader struct {
+	io.Reader
+}
+
+func (unseekableReader) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("illegal seek")
+}
+
+func TestClient_UploadFileUnseekable(t *testing.T) {
+	var part map[string]string
+	ts := uploadServer(t, &part)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	_, err := client.UploadFile(context.Background(), "notes", unseekableReader{strings.NewReader("hello")}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", part["content_type"])
+	assert.Equal(t, "hello", part["content"])
+
+	// it is sent once since it cannot be read again
+	httpClient := &failingHttpClient{}
+	client.httpClient = httpClient
+	_, err = client.UploadFile(context.Background(), "a.txt", unseekableReader{strings.NewReader("content")}, "")
+	assert.EqualError(t, err, "connection reset")
+	assert.Len(t, httpClient.bodies, 1)
+}
+
+// failingHttpClient fails the first request after reading its body and records the bodies
+// it receives.
+type failingHttpClient struct {
+	bodies []string
+}
+
+func (c *failingHttpClient) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	req.Body.Close()
+	c.bodies = append(c.bodies, string(body))
+	if len(c.bodies) == 1 {
+		return nil, errors.New("connection reset")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(fileJSON)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestClient_UploadFileRetries(t *testing.T) {
+	httpClient := &failingHttpClient{}
+	client, err := NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+	client.httpClient = httpClient
+
+	// a seeker is read again from where it started
+	r := strings.NewReader("skip:content")
+	r.Seek(5, io.SeekStart)
+	_, err = client.UploadFile(context.Background(), "a.txt", r, "")
+	require.NoError(t, err)
+	require.Len(t, httpClient.bodies, 2)
+	assert.Contains(t, httpClient.bodies[0], "\r\n\r\ncontent\r\n")
+	assert.Equal(t, httpClient.bodies[0], httpClient.bodies[1])
+
+	// other readers cannot be read again
+	httpClient.bodies = nil
+	_, err = client.UploadFile(context.Background(), "a.txt", io.MultiReader(strings.NewReader("content")), "")
+	assert.EqualError(t, err, "connection reset")
+	assert.Len(t, httpClient.bodies, 1)
+}
+
+func TestClient_Files(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, FilesAPIBeta, r.Header.Get("anthropic-beta"))
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /files":
+			if r.URL.Query().Get("after_id") == "" {
+				w.Write([]byte(`{"data": [` + fileJSON + `], "has_more": true, "first_id": "file_1", "last_id": "file_1"}`))
+			} else {
+				w.Write([]byte(`{"data": [{"id": "file_2", "filename": "chart.png", "downloadable": true}], "has_more": false, "first_id": "file_2", "last_id": "file_2"}`))
+			}
+		case "GET /files/file_1":
+			w.Write([]byte(fileJSON))
+		case "GET /files/file_2/content":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png bytes"))
+		case "DELETE /files/file_1":
+			w.Write([]byte(`{"id": "file_1", "type": "file_deleted"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": {"type": "not_found_error", "message": "file not found"}}`))
+		}
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	var names []string
+	it := client.IterateFiles(ctx, ListOptions{})
+	for it.Next() {
+		names = append(names, it.Current().Filename)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"report.pdf", "chart.png"}, names)
+
+	file, err := client.GetFileMetadata(ctx, "file_1")
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", file.MimeType)
+	assert.Equal(t, 2025, file.CreatedAt.Year())
+
+	body, err := client.DownloadFile(ctx, "file_2")
+	require.NoError(t, err)
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "png bytes", string(content))
+	assert.NoError(t, body.Close())
+
+	_, err = client.DownloadFile(ctx, "file_1")
+	assert.EqualError(t, err, "not_found_error: file not found")
+
+	assert.NoError(t, client.DeleteFile(ctx, "file_1"))
+	assert.EqualError(t, client.DeleteFile(ctx, "file_3"), "not_found_error: file not found")
+}
+
+func TestFileMetadata_Content(t *testing.T) {
+	file := FileMetadata{ID: "file_1"}
+
+	data, err := json.Marshal([]MessageContent{file.DocumentContent("Report", true), file.ImageContent()})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type": "document", "source": {"type": "file", "file_id": "file_1"}, "title": "Report", "citations": {"enabled": true}},
+		{"type": "image", "source": {"type": "file", "file_id": "file_1"}}
+	]`, string(data))
+}
+
+func TestClient_MessageRequestFilesBeta(t *testing.T) {
+	var betas []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		betas = append(betas, r.Header.Get("anthropic-beta"))
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	file := FileMetadata{ID: "file_1"}
+	withFile := MessagePayload{Model: ModelClaude3Dot5Sonnet, MaxTokens: 10, Messages: []Message{
+		{Role: RoleTypeUser, Content: []MessageContent{file.DocumentContent("", false), NewTextContent("Summarize")}},
+	}}
+
+	_, err := client.MessageRequest(ctx, withFile)
+	require.NoError(t, err)
+	_, err = client.MessageRequest(ctx, MessagePayload{Model: ModelClaude3Dot5Sonnet, MaxTokens: 10, Messages: conversation("hi")})
+	require.NoError(t, err)
+
+	client.customHeaders = map[string]string{"anthropic-beta": "token-efficient-tools-2025-02-19"}
+	_, err = client.MessageRequest(ctx, withFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		FilesAPIBeta,
+		"",
+		"token-efficient-tools-2025-02-19," + FilesAPIBeta,
+	}, betas)
+}
@@ -1,6 +1,6 @@
 module github.com/dleviminzi/anthrogo
 
-go 1.21
+go 1.23
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
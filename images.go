@@ -0,0 +1,483 @@
+package anthrogo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+)
+
+// Image source types.
+const (
+	ImageSourceBase64 = "base64"
+	ImageSourceURL    = "url"
+	ImageSourceFile   = "file"
+)
+
+const (
+	// MaxImageDimension is the largest width or height accepted by the API.
+	MaxImageDimension = 8000
+	// MaxImageBytes is the largest base64 encoded image accepted by the API.
+	MaxImageBytes = 5 * 1024 * 1024
+	// RecommendedImageLongEdge is the longest edge above which images are downscaled by
+	// the API anyway. Resizing to it beforehand saves bandwidth and latency.
+	RecommendedImageLongEdge = 1568
+	// MaxImageDecodePixels is the largest number of pixels of an image ImageFromReader
+	// decodes to resize it. The dimensions are read from the header first, so that a small
+	// file declaring huge dimensions is rejected before it is decoded.
+	MaxImageDecodePixels = 100_000_000
+
+	// jpegQuality is used when a JPEG has to be encoded again.
+	jpegQuality = 85
+	// maxImageEncodeAttempts bounds the number of times an image is shrunk to fit the
+	// byte limit.
+	maxImageEncodeAttempts = 8
+)
+
+// ImageOptions controls how images are prepared by ImageFromFile and ImageFromReader.
+type ImageOptions struct {
+	// MaxLongEdge is the longest edge of the prepared image in pixels. It defaults to
+	// MaxImageDimension and may not exceed it; set it to RecommendedImageLongEdge to avoid
+	// sending pixels the API would discard.
+	MaxLongEdge int
+	// MaxBytes is the largest size of the base64 encoded image. It defaults to
+	// MaxImageBytes and may not exceed it.
+	MaxBytes int
+}
+
+// ImageReport describes what was done to an image while preparing it.
+type ImageReport struct {
+	// MediaType is the media type of the prepared image, sniffed from its content.
+	MediaType string
+	// OriginalMediaType differs from MediaType when the image had to be converted, which
+	// happens when a GIF is resized.
+	OriginalMediaType string
+
+	OriginalWidth  int
+	OriginalHeight int
+	Width          int
+	Height         int
+
+	// OriginalBytes and Bytes are the sizes of the raw image before and after preparation.
+	OriginalBytes int
+	Bytes         int
+
+	// Resized reports whether the image was scaled down.
+	Resized bool
+	// Reencoded reports whether the image bytes differ from the input.
+	Reencoded bool
+	// Orientation is the EXIF orientation that was applied to a JPEG before it was encoded
+	// again, 0 when there was none.
+	Orientation int
+}
+
+// ImageFromFile reads an image file and prepares it with ImageFromReader.
+func ImageFromFile(path string, opts ...ImageOptions) (*ImageSource, ImageReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ImageReport{}, err
+	}
+	defer f.Close()
+
+	return ImageFromReader(f, opts...)
+}
+
+// ImageFromReader reads an image and returns a base64 source for it. The media type is
+// sniffed from the content and must be JPEG, PNG, GIF or WebP. JPEG, PNG and GIF images
+// that exceed the limits in opts are downscaled, resized GIFs are sent as PNG since
+// their palette would degrade the result. WebP images cannot be decoded by the standard
+// library and are only accepted when they already fit the byte limit.
+func ImageFromReader(r io.Reader, opts ...ImageOptions) (*ImageSource, ImageReport, error) {
+	options, err := imageOptions(opts)
+	if err != nil {
+		return nil, ImageReport{}, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ImageReport{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	report := ImageReport{
+		MediaType:         mediaType,
+		OriginalMediaType: mediaType,
+		OriginalBytes:     len(data),
+		Bytes:             len(data),
+	}
+
+	switch mediaType {
+	case "image/jpeg", "image/png", "image/gif":
+	case "image/webp":
+		if base64.StdEncoding.EncodedLen(len(data)) > options.MaxBytes {
+			return nil, report, fmt.Errorf("webp image of %d bytes exceeds the limit and cannot be resized", len(data))
+		}
+		return NewBase64ImageSource(mediaType, data), report, nil
+	default:
+		return nil, report, fmt.Errorf("unsupported image media type %q", mediaType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, report, fmt.Errorf("decoding %s: %w", mediaType, err)
+	}
+	report.OriginalWidth, report.OriginalHeight = config.Width, config.Height
+	report.Width, report.Height = config.Width, config.Height
+
+	if max(config.Width, config.Height) <= options.MaxLongEdge && base64.StdEncoding.EncodedLen(len(data)) <= options.MaxBytes {
+		return NewBase64ImageSource(mediaType, data), report, nil
+	}
+
+	if int64(config.Width)*int64(config.Height) > MaxImageDecodePixels {
+		return nil, report, fmt.Errorf("image of %dx%d pixels exceeds the limit of %d pixels", config.Width, config.Height, MaxImageDecodePixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, report, fmt.Errorf("decoding %s: %w", mediaType, err)
+	}
+	if mediaType == "image/jpeg" {
+		if orientation := jpegOrientation(data); orientation > 1 {
+			img = orient(img, orientation)
+			report.Orientation = orientation
+		}
+	}
+
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(options.MaxLongEdge)/float64(max(bounds.Dx(), bounds.Dy())))
+
+	for attempt := 0; attempt < maxImageEncodeAttempts; attempt++ {
+		width := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+		height := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+
+		resized := img
+		if width != bounds.Dx() || height != bounds.Dy() {
+			resized = resizeImage(img, width, height)
+		}
+
+		encoded, encodedType, err := encodeImage(resized, mediaType)
+		if err != nil {
+			return nil, report, err
+		}
+
+		size := base64.StdEncoding.EncodedLen(len(encoded))
+		if size <= options.MaxBytes {
+			report.MediaType = encodedType
+			report.Width, report.Height = width, height
+			report.Bytes = len(encoded)
+			report.Resized = width != bounds.Dx() || height != bounds.Dy()
+			report.Reencoded = true
+			return NewBase64ImageSource(encodedType, encoded), report, nil
+		}
+
+		// shrink the area in proportion to the excess, with some margin for compression
+		scale *= math.Sqrt(float64(options.MaxBytes)/float64(size)) * 0.95
+	}
+
+	return nil, report, fmt.Errorf("image could not be reduced below %d bytes", options.MaxBytes)
+}
+
+// NewImageContent returns an image block for the given source.
+func NewImageContent(source *ImageSource) MessageContent {
+	return MessageContent{Type: ContentTypeImage, Image: source}
+}
+
+// NewBase64ImageSource returns a source holding the given image. Unlike ImageFromReader
+// it does not inspect the image.
+func NewBase64ImageSource(mediaType string, data []byte) *ImageSource {
+	return &ImageSource{Type: ImageSourceBase64, MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}
+}
+
+// NewURLImageSource returns a source referring to an image the API downloads from url.
+func NewURLImageSource(url string) *ImageSource {
+	return &ImageSource{Type: ImageSourceURL, URL: url}
+}
+
+// NewFileImageSource returns a source referring to an image uploaded through the Files API.
+func NewFileImageSource(fileID string) *ImageSource {
+	return &ImageSource{Type: ImageSourceFile, FileID: fileID}
+}
+
+// validate checks that the fields set on the source match its type.
+func (s *ImageSource) validate() error {
+	if s == nil {
+		return errors.New("image has no source")
+	}
+
+	switch s.Type {
+	case ImageSourceBase64:
+		switch s.MediaType {
+		case "image/jpeg", "image/png", "image/gif", "image/webp":
+		default:
+			return fmt.Errorf("unsupported image media type %q", s.MediaType)
+		}
+		if s.Data == "" {
+			return errors.New("base64 image has no data")
+		}
+		if s.URL != "" || s.FileID != "" {
+			return errors.New("base64 image may not have a url or file_id")
+		}
+	case ImageSourceURL:
+		if err := validateSourceURL(s.URL); err != nil {
+			return fmt.Errorf("url image: %w", err)
+		}
+		if s.MediaType != "" || s.Data != "" || s.FileID != "" {
+			return errors.New("url image may only have a url")
+		}
+	case ImageSourceFile:
+		if s.FileID == "" {
+			return errors.New("file image has no file_id")
+		}
+		if s.MediaType != "" || s.Data != "" || s.URL != "" {
+			return errors.New("file image may only have a file_id")
+		}
+	default:
+		return fmt.Errorf("unknown image source type %q", s.Type)
+	}
+
+	return nil
+}
+
+// imageOptions fills in the defaults of the options and checks them against the API limits.
+func imageOptions(opts []ImageOptions) (ImageOptions, error) {
+	var options ImageOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	if options.MaxLongEdge == 0 {
+		options.MaxLongEdge = MaxImageDimension
+	}
+	if options.MaxBytes == 0 {
+		options.MaxBytes = MaxImageBytes
+	}
+
+	if options.MaxLongEdge < 0 || options.MaxLongEdge > MaxImageDimension {
+		return options, fmt.Errorf("max long edge must be between 1 and %d, got %d", MaxImageDimension, options.MaxLongEdge)
+	}
+	if options.MaxBytes < 0 || options.MaxBytes > MaxImageBytes {
+		return options, fmt.Errorf("max bytes must be between 1 and %d, got %d", MaxImageBytes, options.MaxBytes)
+	}
+
+	return options, nil
+}
+
+// encodeImage encodes img in the format of the original image. GIFs are encoded as PNG.
+func encodeImage(img image.Image, mediaType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch mediaType {
+	case "image/jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), mediaType, nil
+	case "image/png", "image/gif":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	default:
+		return nil, "", fmt.Errorf("cannot encode %s", mediaType)
+	}
+}
+
+// toRGBA returns img as an RGBA image whose bounds start at the origin.
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// contribution is the weight of a source pixel in a destination pixel.
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// areaWeights returns, for each of the dst pixels along an axis, the source pixels it
+// covers and how much of each it covers. Weights of a destination pixel sum to 1.
+func areaWeights(src, dst int) [][]contribution {
+	scale := float64(src) / float64(dst)
+	weights := make([][]contribution, dst)
+
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for s := int(start); s < src && float64(s) < end; s++ {
+			covered := math.Min(end, float64(s+1)) - math.Max(start, float64(s))
+			if covered > 0 {
+				weights[i] = append(weights[i], contribution{index: s, weight: covered / scale})
+			}
+		}
+	}
+
+	return weights
+}
+
+// resizeImage downscales img to width x height by averaging the source pixels covered by
+// each destination pixel. This is exact for downscaling, which is all that is needed here.
+func resizeImage(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// horizontal pass into a floating point buffer of width x srcHeight
+	columns := areaWeights(srcWidth, width)
+	tmp := make([]float64, width*srcHeight*4)
+	for y := 0; y < srcHeight; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, contributions := range columns {
+			out := tmp[(y*width+x)*4:]
+			for _, c := range contributions {
+				for k := 0; k < 4; k++ {
+					out[k] += float64(row[c.index*4+k]) * c.weight
+				}
+			}
+		}
+	}
+
+	// vertical pass into the destination
+	rows := areaWeights(srcHeight, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, contributions := range rows {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, c := range contributions {
+				in := tmp[(c.index*width+x)*4:]
+				for k := 0; k < 4; k++ {
+					sum[k] += in[k] * c.weight
+				}
+			}
+			out := dst.Pix[y*dst.Stride+x*4:]
+			for k := 0; k < 4; k++ {
+				out[k] = uint8(math.Min(255, math.Round(sum[k])))
+			}
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, or 0 when it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 0
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// start of scan or end of image: no more metadata
+			return 0
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 0
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+
+	return 0
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+
+	return 0
+}
+
+// orient transforms img so that it is displayed upright according to its EXIF orientation.
+// The metadata is lost when the image is encoded again, so it has to be applied to the
+// pixels.
+func orient(img image.Image, orientation int) image.Image {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// orientations 5 to 8 swap the axes
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:])
+		}
+	}
+
+	return dst
+}
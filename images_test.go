@@ -0,0 +1,361 @@
+package anthrogo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func decodeSource(t *testing.T, source *ImageSource) image.Image {
+	data, err := base64.StdEncoding.DecodeString(source.Data)
+	require.NoError(t, err)
+	img, _, err := image.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	return img
+}
+
+// withOrientation inserts an EXIF segment holding the given orientation after the SOI
+// marker of a JPEG.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestImageFromReader(t *testing.T) {
+	t.Run("small image is passed through", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, testImage(30, 20), nil))
+
+		source, report, err := ImageFromReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		assert.Equal(t, &ImageSource{Type: "base64", MediaType: "image/jpeg", Data: base64.StdEncoding.EncodeToString(buf.Bytes())}, source)
+		assert.Equal(t, ImageReport{
+			MediaType:         "image/jpeg",
+			OriginalMediaType: "image/jpeg",
+			OriginalWidth:     30,
+			OriginalHeight:    20,
+			Width:             30,
+			Height:            20,
+			OriginalBytes:     buf.Len(),
+			Bytes:             buf.Len(),
+		}, report)
+	})
+
+	t.Run("long edge", func(t *testing.T) {
+		source, report, err := ImageFromReader(bytes.NewReader(encodePNG(t, testImage(100, 50))), ImageOptions{MaxLongEdge: 40})
+		require.NoError(t, err)
+
+		assert.Equal(t, "image/png", source.MediaType)
+		assert.Equal(t, image.Rect(0, 0, 40, 20), decodeSource(t, source).Bounds())
+		assert.True(t, report.Resized)
+		assert.True(t, report.Reencoded)
+		assert.Equal(t, 100, report.OriginalWidth)
+		assert.Equal(t, 40, report.Width)
+		assert.Equal(t, 20, report.Height)
+	})
+
+	t.Run("byte limit", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		noise := image.NewRGBA(image.Rect(0, 0, 200, 200))
+		rng.Read(noise.Pix)
+		data := encodePNG(t, noise)
+
+		source, report, err := ImageFromReader(bytes.NewReader(data), ImageOptions{MaxBytes: 40000})
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, len(source.Data), 40000)
+		assert.Less(t, report.Width, 200)
+		assert.Equal(t, report.Width, report.Height)
+		assert.True(t, report.Resized)
+		assert.Less(t, report.Bytes, report.OriginalBytes)
+	})
+
+	t.Run("resized gif becomes png", func(t *testing.T) {
+		paletted := image.NewPaletted(image.Rect(0, 0, 60, 60), color.Palette{color.Black, color.White})
+		var buf bytes.Buffer
+		require.NoError(t, gif.Encode(&buf, paletted, nil))
+
+		source, report, err := ImageFromReader(&buf, ImageOptions{MaxLongEdge: 30})
+		require.NoError(t, err)
+
+		assert.Equal(t, "image/png", source.MediaType)
+		assert.Equal(t, "image/png", report.MediaType)
+		assert.Equal(t, "image/gif", report.OriginalMediaType)
+		assert.Equal(t, image.Rect(0, 0, 30, 30), decodeSource(t, source).Bounds())
+	})
+
+	t.Run("exif orientation is applied", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, testImage(80, 40), nil))
+
+		source, report, err := ImageFromReader(bytes.NewReader(withOrientation(buf.Bytes(), 6)), ImageOptions{MaxLongEdge: 40})
+		require.NoError(t, err)
+
+		assert.Equal(t, 6, report.Orientation)
+		assert.Equal(t, image.Rect(0, 0, 20, 40), decodeSource(t, source).Bounds())
+	})
+
+	t.Run("rotated image is not reported as resized", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, testImage(80, 40), &jpeg.Options{Quality: 100}))
+		data := withOrientation(buf.Bytes(), 6)
+
+		// the image is only encoded again to fit the byte limit
+		_, report, err := ImageFromReader(bytes.NewReader(data), ImageOptions{MaxBytes: base64.StdEncoding.EncodedLen(len(data)) - 1})
+		require.NoError(t, err)
+
+		assert.Equal(t, 6, report.Orientation)
+		assert.Equal(t, 40, report.Width)
+		assert.Equal(t, 80, report.Height)
+		assert.True(t, report.Reencoded)
+		assert.False(t, report.Resized)
+	})
+
+	t.Run("huge dimensions are rejected before decoding", func(t *testing.T) {
+		paletted := image.NewPaletted(image.Rect(0, 0, 60, 60), color.Palette{color.Black, color.White})
+		var buf bytes.Buffer
+		require.NoError(t, gif.Encode(&buf, paletted, nil))
+
+		// a few bytes declaring a 50000x50000 screen
+		data := buf.Bytes()
+		binary.LittleEndian.PutUint16(data[6:], 50000)
+		binary.LittleEndian.PutUint16(data[8:], 50000)
+
+		_, report, err := ImageFromReader(bytes.NewReader(data))
+		assert.EqualError(t, err, "image of 50000x50000 pixels exceeds the limit of 100000000 pixels")
+		assert.Equal(t, 50000, report.OriginalWidth)
+	})
+
+	t.Run("webp", func(t *testing.T) {
+		webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 64)...)
+
+		source, report, err := ImageFromReader(bytes.NewReader(webp))
+		require.NoError(t, err)
+		assert.Equal(t, "image/webp", source.MediaType)
+		assert.False(t, report.Reencoded)
+
+		_, _, err = ImageFromReader(bytes.NewReader(webp), ImageOptions{MaxBytes: 10})
+		assert.EqualError(t, err, "webp image of 80 bytes exceeds the limit and cannot be resized")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, report, err := ImageFromReader(strings.NewReader("%PDF-1.7"))
+		assert.EqualError(t, err, `unsupported image media type "application/pdf"`)
+		assert.Equal(t, "application/pdf", report.OriginalMediaType)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, _, err := ImageFromReader(strings.NewReader(""), ImageOptions{MaxLongEdge: 9000})
+		assert.EqualError(t, err, "max long edge must be between 1 and 8000, got 9000")
+	})
+}
+
+func TestImageFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	require.NoError(t, os.WriteFile(path, encodePNG(t, testImage(10, 10)), 0o600))
+
+	source, _, err := ImageFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, NewImageContent(source), MessageContent{Type: ContentTypeImage, Image: source})
+	assert.Equal(t, "image/png", source.MediaType)
+
+	_, _, err = ImageFromFile(filepath.Join(t.TempDir(), "missing.png"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			value := uint8(0)
+			if x%2 == 1 {
+				value = 200
+			}
+			src.Set(x, y, color.RGBA{R: value, G: value, B: value, A: 255})
+		}
+	}
+
+	dst := resizeImage(src, 2, 1)
+	assert.Equal(t, color.RGBA{R: 100, G: 100, B: 100, A: 255}, dst.At(0, 0))
+	assert.Equal(t, color.RGBA{R: 100, G: 100, B: 100, A: 255}, dst.At(1, 0))
+
+	// non integer ratios split pixels between destination pixels
+	dst = resizeImage(src, 3, 1)
+	assert.Equal(t, color.RGBA{R: 50, G: 50, B: 50, A: 255}, dst.At(0, 0))
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	// 6: rotate 90 degrees clockwise, the top left pixel ends up top right
+	dst := orient(src, 6)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), dst.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, dst.At(0, 0))
+
+	// 3: rotate 180 degrees
+	dst = orient(src, 3)
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, dst.At(1, 0))
+}
+
+func TestMessagePayload_ValidateImages(t *testing.T) {
+	testCases := []struct {
+		name          string
+		source        *ImageSource
+		expectedError string
+	}{
+		{
+			name:   "base64",
+			source: NewBase64ImageSource("image/png", []byte("png")),
+		},
+		{
+			name:   "url",
+			source: NewURLImageSource("https://cdn.example.com/cat.jpg"),
+		},
+		{
+			name:   "file",
+			source: NewFileImageSource("file_1"),
+		},
+		{
+			name:          "missing source",
+			expectedError: "message 0 block 0: image has no source",
+		},
+		{
+			name:          "unsupported media type",
+			source:        NewBase64ImageSource("image/tiff", []byte("tiff")),
+			expectedError: `message 0 block 0: unsupported image media type "image/tiff"`,
+		},
+		{
+			name:          "base64 with url",
+			source:        &ImageSource{Type: ImageSourceBase64, MediaType: "image/png", Data: "x", URL: "https://cdn.example.com/cat.jpg"},
+			expectedError: "message 0 block 0: base64 image may not have a url or file_id",
+		},
+		{
+			name:          "url with data",
+			source:        &ImageSource{Type: ImageSourceURL, URL: "https://cdn.example.com/cat.jpg", MediaType: "image/jpeg", Data: "x"},
+			expectedError: "message 0 block 0: url image may only have a url",
+		},
+		{
+			name:          "missing url",
+			source:        &ImageSource{Type: ImageSourceURL},
+			expectedError: "message 0 block 0: url image: missing url",
+		},
+		{
+			name:          "file with media type",
+			source:        &ImageSource{Type: ImageSourceFile, FileID: "file_1", MediaType: "image/png"},
+			expectedError: "message 0 block 0: file image may only have a file_id",
+		},
+		{
+			name:          "missing file id",
+			source:        NewFileImageSource(""),
+			expectedError: "message 0 block 0: file image has no file_id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := MessagePayload{Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{NewImageContent(tc.source)}}}}
+			err := payload.validate()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("tool result", func(t *testing.T) {
+		payload := MessagePayload{Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+			NewToolResultContent("t", NewTextContent("see image"), NewImageContent(NewFileImageSource(""))),
+		}}}}
+		assert.EqualError(t, payload.validate(), "message 0 block 0 content 1: file image has no file_id")
+	})
+}
+
+func TestClient_MessageRequestSources(t *testing.T) {
+	var received json.RawMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Messages []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		received = payload.Messages[0].Content
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer ts.Close()
+
+	_, err := newTestClient(t, ts.URL).MessageRequest(context.Background(), MessagePayload{
+		Model:     ModelClaude3Dot5Sonnet,
+		MaxTokens: 10,
+		Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+			NewImageContent(NewBase64ImageSource("image/png", []byte("png"))),
+			NewImageContent(NewURLImageSource("https://cdn.example.com/cat.jpg")),
+			NewImageContent(NewFileImageSource("file_image")),
+			NewDocumentContent(NewPDFDocumentSource([]byte("%PDF")), "", false),
+			NewDocumentContent(NewURLDocumentSource("https://example.com/report.pdf"), "", false),
+			NewDocumentContent(NewFileDocumentSource("file_document"), "", false),
+		}}},
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[
+		{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "cG5n"}},
+		{"type": "image", "source": {"type": "url", "url": "https://cdn.example.com/cat.jpg"}},
+		{"type": "image", "source": {"type": "file", "file_id": "file_image"}},
+		{"type": "document", "source": {"type": "base64", "media_type": "application/pdf", "data": "JVBERg=="}},
+		{"type": "document", "source": {"type": "url", "url": "https://example.com/report.pdf"}},
+		{"type": "document", "source": {"type": "file", "file_id": "file_document"}}
+	]`, string(received))
+}
@@ -18,36 +18,62 @@ type MessageEventPayload struct {
 // and Data which is the full data from the event
 type EventData struct {
 	Content string
-	Data    any
+	Data    StreamEvent
+	// Thinking is the thinking text of a thinking block, kept apart from the visible Content.
+	Thinking string
+	// Citation is the citation added to a text block by a citations_delta event.
+	Citation *Citation
+	// PartialJSON is the tool input received so far for the block of an input_json_delta event.
+	PartialJSON string
+	// PartialInput is the best-effort parse of PartialJSON, set when DecodeOptions.PartialInput is enabled.
+	PartialInput *PartialJSON
+	// ToolUse is the completed tool_use block, set on the content_block_stop event of a tool_use block.
+	ToolUse *ContentBlock
+	// Input is the parsed input of ToolUse.
+	Input map[string]any
 }
 
+// StreamEvent is the data of an event of a message stream. It is implemented by one type per
+// event, so that a type switch handles a stream:
+//
+//	switch event := payload.Data.Data.(type) {
+//	case MessageStart:
+//	case ContentBlockStart:
+//	case ContentBlockDelta:
+//	case ContentBlockStop:
+//	case MessageDelta:
+//	case MessageStopData:
+//	case PingData:
+//	case UnknownEvent:
+//	}
+//
+// ErrorData is not delivered as an event; the decoder returns error events as errors.
+type StreamEvent interface {
+	isStreamEvent()
+}
+
+func (MessageStart) isStreamEvent()      {}
+func (ContentBlockStart) isStreamEvent() {}
+func (PingData) isStreamEvent()          {}
+func (ContentBlockDelta) isStreamEvent() {}
+func (ContentBlockStop) isStreamEvent()  {}
+func (MessageDelta) isStreamEvent()      {}
+func (MessageStopData) isStreamEvent()   {}
+func (ErrorData) isStreamEvent()         {}
+func (UnknownEvent) isStreamEvent()      {}
+
 // MessageStart is one of the data types for events and it represents the start of a
-// a stream of messages. It contains metadata about the request.
+// a stream of messages. Its message has no content yet and the usage of the input.
 type MessageStart struct {
-	Type    string `json:"type"`
-	Message struct {
-		ID           string   `json:"id"`
-		Type         string   `json:"type"`
-		Role         string   `json:"role"`
-		Content      []string `json:"content"`
-		Model        string   `json:"model"`
-		StopReason   string   `json:"stop_reason"`
-		StopSequence string   `json:"stop_sequence"`
-		Usage        struct {
-			InputTokens  int `json:"input_tokens"`
-			OutputTokens int `json:"output_tokens"`
-		} `json:"usage"`
-	} `json:"message"`
+	Type    string          `json:"type"`
+	Message MessageResponse `json:"message"`
 }
 
 // ContentBlockStart marks the start of a new content block in the message stream.
 type ContentBlockStart struct {
-	Type         string `json:"type"`
-	Index        int    `json:"index"`
-	ContentBlock struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"content_block"`
+	Type         string       `json:"type"`
+	Index        int          `json:"index"`
+	ContentBlock ContentBlock `json:"content_block"`
 }
 
 // PingData is a ping event
@@ -57,12 +83,22 @@ type PingData struct {
 
 // ContentBlockDelta carries new content for a content block in the message stream.
 type ContentBlockDelta struct {
-	Type  string `json:"type"`
-	Index int    `json:"index"`
-	Delta struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"delta"`
+	Type  string       `json:"type"`
+	Index int          `json:"index"`
+	Delta ContentDelta `json:"delta"`
+}
+
+// ContentDelta is the new content of a ContentBlockDelta. Text deltas carry Text,
+// input_json_delta deltas carry a fragment of a tool_use input in PartialJSON,
+// thinking_delta deltas carry Thinking, signature_delta deltas carry Signature and
+// citations_delta deltas carry a Citation for the text block.
+type ContentDelta struct {
+	Type        string    `json:"type"`
+	Text        string    `json:"text,omitempty"`
+	PartialJSON string    `json:"partial_json,omitempty"`
+	Thinking    string    `json:"thinking,omitempty"`
+	Signature   string    `json:"signature,omitempty"`
+	Citation    *Citation `json:"citation,omitempty"`
 }
 
 // ContentBlockStop marks the end of a content block in the message stream.
@@ -71,13 +107,19 @@ type ContentBlockStop struct {
 	Index int    `json:"index"`
 }
 
-// MessageDelta events indicate top-level changes to the final message.
+// MessageDelta events indicate top-level changes to the final message. The usage is
+// cumulative: it replaces the usage reported so far rather than adding to it.
 type MessageDelta struct {
-	Type  string      `json:"type"`
-	Delta interface{} `json:"delta"`
-	Usage struct {
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
+	Type  string    `json:"type"`
+	Delta StopDelta `json:"delta"`
+	Usage Usage     `json:"usage"`
+}
+
+// StopDelta tells why the model stopped. StopSequence is set when StopReason is
+// "stop_sequence".
+type StopDelta struct {
+	StopReason   string `json:"stop_reason"`
+	StopSequence string `json:"stop_sequence"`
 }
 
 // MessageStopData is the final event in a message stream.
@@ -94,6 +136,13 @@ type ErrorData struct {
 	} `json:"error"`
 }
 
+// UnknownEvent is an event this package does not know about, such as one added to the API
+// after this release. Data is the raw JSON data of the event.
+type UnknownEvent struct {
+	Type string
+	Data json.RawMessage
+}
+
 // MessageEvent is the event type for messages. It contains the message payload
 // and an error if one occurred.
 type MessageEvent struct {
@@ -104,19 +153,21 @@ type MessageEvent struct {
 // MessageSSEDecoder is a decoder for the SSE stream from the message endpoint.
 type MessageSSEDecoder struct {
 	reader  *bufio.Reader
-	content []string
+	message *MessageAccumulator
 }
 
 // DecodeOptions are options for decoding the SSE stream.
 type DecodeOptions struct {
 	ContentOnly bool
+	// PartialInput parses the tool input received so far on every input_json_delta event.
+	PartialInput bool
 }
 
 // NewMessageSSEDecoder creates a new MessageSSEDecoder.
 func NewMessageSSEDecoder(reader io.Reader) *MessageSSEDecoder {
 	return &MessageSSEDecoder{
 		reader:  bufio.NewReader(reader),
-		content: make([]string, 0),
+		message: NewMessageAccumulator(),
 	}
 }
 
@@ -156,6 +207,12 @@ func (d *MessageSSEDecoder) Decode(opts ...DecodeOptions) (*MessageEventPayload,
 		if err != nil {
 			return nil, err
 		}
+		if err := d.message.Apply(&MessageEventPayload{Event: value, Data: data}); err != nil {
+			return nil, err
+		}
+		if err := d.addToolInput(&data, options); err != nil {
+			return nil, err
+		}
 
 		if data.Content != "" || !options.ContentOnly || value == "message_stop" {
 			return &MessageEventPayload{
@@ -201,7 +258,7 @@ func (d *MessageSSEDecoder) decodeData(event string) (EventData, error) {
 				}
 				eventData.Data = contentBlockStartData
 				eventData.Content = contentBlockStartData.ContentBlock.Text
-				d.updateContent(contentBlockStartData.Index, contentBlockStartData.ContentBlock.Text)
+				eventData.Thinking = contentBlockStartData.ContentBlock.Thinking
 			case "ping":
 				var pingData PingData
 				err := json.Unmarshal([]byte(jsonData), &pingData)
@@ -217,7 +274,8 @@ func (d *MessageSSEDecoder) decodeData(event string) (EventData, error) {
 				}
 				eventData.Data = contentBlockDeltaData
 				eventData.Content = contentBlockDeltaData.Delta.Text
-				d.updateContent(contentBlockDeltaData.Index, contentBlockDeltaData.Delta.Text)
+				eventData.Thinking = contentBlockDeltaData.Delta.Thinking
+				eventData.Citation = contentBlockDeltaData.Delta.Citation
 			case "content_block_stop":
 				var contentBlockStopData ContentBlockStop
 				err := json.Unmarshal([]byte(jsonData), &contentBlockStopData)
@@ -246,6 +304,8 @@ func (d *MessageSSEDecoder) decodeData(event string) (EventData, error) {
 					return eventData, err
 				}
 				return eventData, fmt.Errorf("error(%s) -  %s", errorData.Error.Type, errorData.Error.Message)
+			default:
+				eventData.Data = UnknownEvent{Type: event, Data: json.RawMessage(jsonData)}
 			}
 		}
 	}
@@ -253,9 +313,37 @@ func (d *MessageSSEDecoder) decodeData(event string) (EventData, error) {
 	return eventData, nil
 }
 
-func (d *MessageSSEDecoder) updateContent(index int, content string) {
-	if index >= len(d.content) {
-		d.content = append(d.content, make([]string, index-len(d.content)+1)...)
+// Accumulator returns the accumulator the decoded events are applied to, including the ones
+// skipped by DecodeOptions.ContentOnly.
+func (d *MessageSSEDecoder) Accumulator() *MessageAccumulator {
+	return d.message
+}
+
+// addToolInput sets the tool input the accumulator assembled on the event data: the input
+// received so far for input_json_delta events and the completed tool_use block when it stops.
+func (d *MessageSSEDecoder) addToolInput(eventData *EventData, options DecodeOptions) error {
+	switch data := eventData.Data.(type) {
+	case ContentBlockDelta:
+		input := d.message.input(data.Index)
+		if data.Delta.Type != "input_json_delta" || input == nil {
+			return nil
+		}
+
+		eventData.PartialJSON = input.String()
+		if options.PartialInput {
+			partial, err := input.Feed("")
+			if err != nil {
+				return fmt.Errorf("content block %d: invalid tool input JSON: %w", data.Index, err)
+			}
+			eventData.PartialInput = &partial
+		}
+	case ContentBlockStop:
+		block, input, err := d.message.toolUse(data.Index)
+		if err != nil {
+			return err
+		}
+		eventData.ToolUse, eventData.Input = block, input
 	}
-	d.content[index] += content
+
+	return nil
 }
@@ -10,17 +10,17 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestMessageSSEDecoder_Decode(t *testing.T) {
-	testCases := []struct {
-		name           string
-		input          string
-		expectedEvents []*MessageEventPayload
-		expectedError  error
-		options        DecodeOptions
-	}{
-		{
-			name: "valid events",
-			input: `event: message_start
+// messageSSETestCases are streams along with the events they decode to.
+var messageSSETestCases = []struct {
+	name           string
+	input          string
+	expectedEvents []*MessageEventPayload
+	expectedError  error
+	options        DecodeOptions
+}{
+	{
+		name: "valid events",
+		input: `event: message_start
 data: {"type": "message_start", "message": {"id": "1", "type": "text_completion", "role": "assistant", "content": [], "model": "claude", "stop_reason": "stop_sequence", "stop_sequence": null, "usage": {"input_tokens": 5, "output_tokens": 0}}}
 
 event: content_block_start
@@ -32,105 +32,84 @@ data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text", "tex
 event: message_stop
 data: {"type": "message_stop"}
 `,
-			expectedEvents: []*MessageEventPayload{
-				{
-					Event: "message_start",
-					Data: EventData{
-						Data: MessageStart{
-							Type: "message_start",
-							Message: struct {
-								ID           string   "json:\"id\""
-								Type         string   "json:\"type\""
-								Role         string   "json:\"role\""
-								Content      []string "json:\"content\""
-								Model        string   "json:\"model\""
-								StopReason   string   "json:\"stop_reason\""
-								StopSequence string   "json:\"stop_sequence\""
-								Usage        struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								} "json:\"usage\""
-							}{
-								ID:           "1",
-								Type:         "text_completion",
-								Role:         "assistant",
-								Content:      []string{},
-								Model:        "claude",
-								StopReason:   "stop_sequence",
-								StopSequence: "",
-								Usage: struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								}{InputTokens: 5, OutputTokens: 0},
-							},
+		expectedEvents: []*MessageEventPayload{
+			{
+				Event: "message_start",
+				Data: EventData{
+					Data: MessageStart{
+						Type: "message_start",
+						Message: MessageResponse{
+							ID:           "1",
+							Type:         "text_completion",
+							Role:         RoleTypeAssistant,
+							Content:      []ContentBlock{},
+							Model:        "claude",
+							StopReason:   "stop_sequence",
+							StopSequence: "",
+							Usage:        Usage{InputTokens: 5, OutputTokens: 0},
 						},
 					},
 				},
-				{
-					Event: "content_block_start",
-					Data: EventData{
-						Content: "Hello",
-						Data: ContentBlockStart{
-							Type:  "content_block_start",
-							Index: 0,
-							ContentBlock: struct {
-								Type string "json:\"type\""
-								Text string "json:\"text\""
-							}{
-								Type: "text",
-								Text: "Hello",
-							},
+			},
+			{
+				Event: "content_block_start",
+				Data: EventData{
+					Content: "Hello",
+					Data: ContentBlockStart{
+						Type:  "content_block_start",
+						Index: 0,
+						ContentBlock: ContentBlock{
+							Type: "text",
+							Text: "Hello",
 						},
 					},
 				},
-				{
-					Event: "content_block_delta",
-					Data: EventData{
-						Content: " world!",
-						Data: ContentBlockDelta{
-							Type:  "content_block_delta",
-							Index: 0,
-							Delta: struct {
-								Type string "json:\"type\""
-								Text string "json:\"text\""
-							}{
-								Type: "text",
-								Text: " world!",
-							},
+			},
+			{
+				Event: "content_block_delta",
+				Data: EventData{
+					Content: " world!",
+					Data: ContentBlockDelta{
+						Type:  "content_block_delta",
+						Index: 0,
+						Delta: ContentDelta{
+							Type: "text",
+							Text: " world!",
 						},
 					},
 				},
-				{
-					Event: "message_stop",
-					Data: EventData{
-						Data: MessageStopData{
-							Type: "message_stop",
-						},
+			},
+			{
+				Event: "message_stop",
+				Data: EventData{
+					Data: MessageStopData{
+						Type: "message_stop",
 					},
 				},
 			},
 		},
-		{
-			name: "error event",
-			input: `event: error
+	},
+	{
+		name: "error event",
+		input: `event: error
 data: {"type": "error", "error": {"type": "invalid_request_error", "message": "Invalid model"}}
 `,
-			expectedError: errors.New("error(invalid_request_error) -  Invalid model"),
-		},
-		{
-			name:  "empty input",
-			input: "",
-		},
-		{
-			name: "invalid SSE format",
-			input: `event
+		expectedError: errors.New("error(invalid_request_error) -  Invalid model"),
+	},
+	{
+		name:  "empty input",
+		input: "",
+	},
+	{
+		name: "invalid SSE format",
+		input: `event
 data: {"type": "message_start"}
 `,
-			expectedError: errors.New("invalid SSE format"),
-		},
-		{
-			name: "content only",
-			input: `event: message_start
+		expectedError: errors.New("invalid SSE format"),
+	},
+	{
+		name: "content only",
+		input: `event: message_start
 		data: {"type": "message_start", "message": {"id": "1", "type": "text_completion", "role": "assistant", "content": [], "model": "claude", "stop_reason": "stop_sequence", "stop_sequence": null, "usage": {"input_tokens": 5, "output_tokens": 0}}}
 		
 		event: content_block_start
@@ -142,57 +121,51 @@ data: {"type": "message_start"}
 		event: message_stop
 		data: {"type": "message_stop"}
 		`,
-			options: DecodeOptions{
-				ContentOnly: true,
-			},
-			expectedEvents: []*MessageEventPayload{
-				{
-					Event: "content_block_start",
-					Data: EventData{
-						Content: "Hello",
-						Data: ContentBlockStart{
-							Type:  "content_block_start",
-							Index: 0,
-							ContentBlock: struct {
-								Type string "json:\"type\""
-								Text string "json:\"text\""
-							}{
-								Type: "text",
-								Text: "Hello",
-							},
+		options: DecodeOptions{
+			ContentOnly: true,
+		},
+		expectedEvents: []*MessageEventPayload{
+			{
+				Event: "content_block_start",
+				Data: EventData{
+					Content: "Hello",
+					Data: ContentBlockStart{
+						Type:  "content_block_start",
+						Index: 0,
+						ContentBlock: ContentBlock{
+							Type: "text",
+							Text: "Hello",
 						},
 					},
 				},
-				{
-					Event: "content_block_delta",
-					Data: EventData{
-						Content: " world!",
-						Data: ContentBlockDelta{
-							Type:  "content_block_delta",
-							Index: 0,
-							Delta: struct {
-								Type string "json:\"type\""
-								Text string "json:\"text\""
-							}{
-								Type: "text",
-								Text: " world!",
-							},
+			},
+			{
+				Event: "content_block_delta",
+				Data: EventData{
+					Content: " world!",
+					Data: ContentBlockDelta{
+						Type:  "content_block_delta",
+						Index: 0,
+						Delta: ContentDelta{
+							Type: "text",
+							Text: " world!",
 						},
 					},
 				},
-				{
-					Event: "message_stop",
-					Data: EventData{
-						Data: MessageStopData{
-							Type: "message_stop",
-						},
+			},
+			{
+				Event: "message_stop",
+				Data: EventData{
+					Data: MessageStopData{
+						Type: "message_stop",
 					},
 				},
 			},
 		},
-		{
-			name: "content_block_stop event",
-			input: `event: message_start
+	},
+	{
+		name: "content_block_stop event",
+		input: `event: message_start
 		data: {"type": "message_start", "message": {"id": "1", "type": "text_completion", "role": "assistant", "content": [], "model": "claude", "stop_reason": "stop_sequence", "stop_sequence": null, "usage": {"input_tokens": 5, "output_tokens": 0}}}
 		
 		event: content_block_start
@@ -204,156 +177,117 @@ data: {"type": "message_start"}
 		event: message_stop
 		data: {"type": "message_stop"}
 		`,
-			expectedEvents: []*MessageEventPayload{
-				{
-					Event: "message_start",
-					Data: EventData{
-						Data: MessageStart{
-							Type: "message_start",
-							Message: struct {
-								ID           string   "json:\"id\""
-								Type         string   "json:\"type\""
-								Role         string   "json:\"role\""
-								Content      []string "json:\"content\""
-								Model        string   "json:\"model\""
-								StopReason   string   "json:\"stop_reason\""
-								StopSequence string   "json:\"stop_sequence\""
-								Usage        struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								} "json:\"usage\""
-							}{
-								ID:           "1",
-								Type:         "text_completion",
-								Role:         "assistant",
-								Content:      []string{},
-								Model:        "claude",
-								StopReason:   "stop_sequence",
-								StopSequence: "",
-								Usage: struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								}{
-									InputTokens:  5,
-									OutputTokens: 0,
-								},
+		expectedEvents: []*MessageEventPayload{
+			{
+				Event: "message_start",
+				Data: EventData{
+					Data: MessageStart{
+						Type: "message_start",
+						Message: MessageResponse{
+							ID:           "1",
+							Type:         "text_completion",
+							Role:         RoleTypeAssistant,
+							Content:      []ContentBlock{},
+							Model:        "claude",
+							StopReason:   "stop_sequence",
+							StopSequence: "",
+							Usage: Usage{
+								InputTokens:  5,
+								OutputTokens: 0,
 							},
 						},
 					},
 				},
-				{
-					Event: "content_block_start",
-					Data: EventData{
-						Content: "Hello",
-						Data: ContentBlockStart{
-							Type:  "content_block_start",
-							Index: 0,
-							ContentBlock: struct {
-								Type string "json:\"type\""
-								Text string "json:\"text\""
-							}{
-								Type: "text",
-								Text: "Hello",
-							},
+			},
+			{
+				Event: "content_block_start",
+				Data: EventData{
+					Content: "Hello",
+					Data: ContentBlockStart{
+						Type:  "content_block_start",
+						Index: 0,
+						ContentBlock: ContentBlock{
+							Type: "text",
+							Text: "Hello",
 						},
 					},
 				},
-				{
-					Event: "content_block_stop",
-					Data: EventData{
-						Data: ContentBlockStop{
-							Type:  "content_block_stop",
-							Index: 0,
-						},
+			},
+			{
+				Event: "content_block_stop",
+				Data: EventData{
+					Data: ContentBlockStop{
+						Type:  "content_block_stop",
+						Index: 0,
 					},
 				},
-				{
-					Event: "message_stop",
-					Data: EventData{
-						Data: MessageStopData{
-							Type: "message_stop",
-						},
+			},
+			{
+				Event: "message_stop",
+				Data: EventData{
+					Data: MessageStopData{
+						Type: "message_stop",
 					},
 				},
 			},
 		},
-		{
-			name: "message_delta event",
-			input: `event: message_start
+	},
+	{
+		name: "message_delta event",
+		input: `event: message_start
 		data: {"type": "message_start", "message": {"id": "1", "type": "text_completion", "role": "assistant", "content": [], "model": "claude", "stop_reason": "stop_sequence", "stop_sequence": null, "usage": {"input_tokens": 5, "output_tokens": 0}}}
 		
 		event: message_delta
-		data: {"type": "message_delta", "delta": {"output_tokens": 10}, "usage": {"output_tokens": 10}}
+		data: {"type": "message_delta", "delta": {"stop_reason": "end_turn", "stop_sequence": null}, "usage": {"output_tokens": 10}}
 		
 		event: message_stop
 		data: {"type": "message_stop"}
 		`,
-			expectedEvents: []*MessageEventPayload{
-				{
-					Event: "message_start",
-					Data: EventData{
-						Data: MessageStart{
-							Type: "message_start",
-							Message: struct {
-								ID           string   "json:\"id\""
-								Type         string   "json:\"type\""
-								Role         string   "json:\"role\""
-								Content      []string "json:\"content\""
-								Model        string   "json:\"model\""
-								StopReason   string   "json:\"stop_reason\""
-								StopSequence string   "json:\"stop_sequence\""
-								Usage        struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								} "json:\"usage\""
-							}{
-								ID:           "1",
-								Type:         "text_completion",
-								Role:         "assistant",
-								Content:      []string{},
-								Model:        "claude",
-								StopReason:   "stop_sequence",
-								StopSequence: "",
-								Usage: struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								}{
-									InputTokens:  5,
-									OutputTokens: 0,
-								},
+		expectedEvents: []*MessageEventPayload{
+			{
+				Event: "message_start",
+				Data: EventData{
+					Data: MessageStart{
+						Type: "message_start",
+						Message: MessageResponse{
+							ID:           "1",
+							Type:         "text_completion",
+							Role:         RoleTypeAssistant,
+							Content:      []ContentBlock{},
+							Model:        "claude",
+							StopReason:   "stop_sequence",
+							StopSequence: "",
+							Usage: Usage{
+								InputTokens:  5,
+								OutputTokens: 0,
 							},
 						},
 					},
 				},
-				{
-					Event: "message_delta",
-					Data: EventData{
-						Data: MessageDelta{
-							Type: "message_delta",
-							Delta: map[string]interface{}{
-								"output_tokens": float64(10),
-							},
-							Usage: struct {
-								OutputTokens int "json:\"output_tokens\""
-							}{
-								OutputTokens: 10,
-							},
-						},
+			},
+			{
+				Event: "message_delta",
+				Data: EventData{
+					Data: MessageDelta{
+						Type:  "message_delta",
+						Delta: StopDelta{StopReason: "end_turn"},
+						Usage: Usage{OutputTokens: 10},
 					},
 				},
-				{
-					Event: "message_stop",
-					Data: EventData{
-						Data: MessageStopData{
-							Type: "message_stop",
-						},
+			},
+			{
+				Event: "message_stop",
+				Data: EventData{
+					Data: MessageStopData{
+						Type: "message_stop",
 					},
 				},
 			},
 		},
-		{
-			name: "ping event",
-			input: `event: message_start
+	},
+	{
+		name: "ping event",
+		input: `event: message_start
 		data: {"type": "message_start", "message": {"id": "1", "type": "text_completion", "role": "assistant", "content": [], "model": "claude", "stop_reason": "stop_sequence", "stop_sequence": null, "usage": {"input_tokens": 5, "output_tokens": 0}}}
 		
 		event: ping
@@ -362,64 +296,50 @@ data: {"type": "message_start"}
 		event: message_stop
 		data: {"type": "message_stop"}
 		`,
-			expectedEvents: []*MessageEventPayload{
-				{
-					Event: "message_start",
-					Data: EventData{
-						Data: MessageStart{
-							Type: "message_start",
-							Message: struct {
-								ID           string   "json:\"id\""
-								Type         string   "json:\"type\""
-								Role         string   "json:\"role\""
-								Content      []string "json:\"content\""
-								Model        string   "json:\"model\""
-								StopReason   string   "json:\"stop_reason\""
-								StopSequence string   "json:\"stop_sequence\""
-								Usage        struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								} "json:\"usage\""
-							}{
-								ID:           "1",
-								Type:         "text_completion",
-								Role:         "assistant",
-								Content:      []string{},
-								Model:        "claude",
-								StopReason:   "stop_sequence",
-								StopSequence: "",
-								Usage: struct {
-									InputTokens  int "json:\"input_tokens\""
-									OutputTokens int "json:\"output_tokens\""
-								}{
-									InputTokens:  5,
-									OutputTokens: 0,
-								},
+		expectedEvents: []*MessageEventPayload{
+			{
+				Event: "message_start",
+				Data: EventData{
+					Data: MessageStart{
+						Type: "message_start",
+						Message: MessageResponse{
+							ID:           "1",
+							Type:         "text_completion",
+							Role:         RoleTypeAssistant,
+							Content:      []ContentBlock{},
+							Model:        "claude",
+							StopReason:   "stop_sequence",
+							StopSequence: "",
+							Usage: Usage{
+								InputTokens:  5,
+								OutputTokens: 0,
 							},
 						},
 					},
 				},
-				{
-					Event: "ping",
-					Data: EventData{
-						Data: PingData{
-							Type: "ping",
-						},
+			},
+			{
+				Event: "ping",
+				Data: EventData{
+					Data: PingData{
+						Type: "ping",
 					},
 				},
-				{
-					Event: "message_stop",
-					Data: EventData{
-						Data: MessageStopData{
-							Type: "message_stop",
-						},
+			},
+			{
+				Event: "message_stop",
+				Data: EventData{
+					Data: MessageStopData{
+						Type: "message_stop",
 					},
 				},
 			},
 		},
-	}
+	},
+}
 
-	for _, tc := range testCases {
+func TestMessageSSEDecoder_Decode(t *testing.T) {
+	for _, tc := range messageSSETestCases {
 		t.Run(tc.name, func(t *testing.T) {
 			decoder := NewMessageSSEDecoder(strings.NewReader(tc.input))
 
@@ -454,19 +374,6 @@ func TestMessageSSEDecoder_DecodeOptions(t *testing.T) {
 	assert.EqualError(t, err, "too many options provided, expected at most one")
 }
 
-func TestMessageSSEDecoder_updateContent(t *testing.T) {
-	decoder := NewMessageSSEDecoder(nil)
-
-	decoder.updateContent(0, "Hello")
-	assert.Equal(t, []string{"Hello"}, decoder.content)
-
-	decoder.updateContent(2, "!")
-	assert.Equal(t, []string{"Hello", "", "!"}, decoder.content)
-
-	decoder.updateContent(1, " world")
-	assert.Equal(t, []string{"Hello", " world", "!"}, decoder.content)
-}
-
 type errReader struct{}
 
 func (r errReader) Read(p []byte) (n int, err error) {
@@ -479,3 +386,164 @@ func TestMessageSSEDecoder_DecodeError(t *testing.T) {
 	_, err := decoder.Decode()
 	assert.EqualError(t, err, io.ErrUnexpectedEOF.Error())
 }
+
+// toolUseStream streams the input of a tool_use block in fragments.
+const toolUseStream = `event: content_block_start
+data: {"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": ""}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"city\": \"Par"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "is\"}"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 1}
+`
+
+func TestMessageSSEDecoder_ToolUse(t *testing.T) {
+	input := toolUseStream
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	event, err := decoder.Decode()
+	require.NoError(t, err)
+	start := event.Data.Data.(ContentBlockStart)
+	assert.Equal(t, "toolu_1", start.ContentBlock.ID)
+	assert.Equal(t, "get_weather", start.ContentBlock.Name)
+
+	var partials []string
+	for i := 0; i < 3; i++ {
+		event, err = decoder.Decode()
+		require.NoError(t, err)
+		assert.Empty(t, event.Data.Content)
+		partials = append(partials, event.Data.PartialJSON)
+	}
+	assert.Equal(t, []string{"", `{"city": "Par`, `{"city": "Paris"}`}, partials)
+
+	event, err = decoder.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "content_block_stop", event.Event)
+	require.NotNil(t, event.Data.ToolUse)
+	assert.Equal(t, "toolu_1", event.Data.ToolUse.ID)
+	assert.Equal(t, "get_weather", event.Data.ToolUse.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, string(event.Data.ToolUse.Input))
+	assert.Equal(t, map[string]any{"city": "Paris"}, event.Data.Input)
+
+	// the block is the one the accumulator assembled
+	assert.Equal(t, *event.Data.ToolUse, decoder.Accumulator().Snapshot().Content[1])
+}
+
+func TestMessageSSEDecoder_ToolUseWithoutInput(t *testing.T) {
+	input := `event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "now", "input": {}}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	_, err := decoder.Decode()
+	require.NoError(t, err)
+
+	event, err := decoder.Decode()
+	require.NoError(t, err)
+	require.NotNil(t, event.Data.ToolUse)
+	assert.Equal(t, map[string]any{}, event.Data.Input)
+}
+
+func TestMessageSSEDecoder_ToolUseInvalidJSON(t *testing.T) {
+	input := `event: content_block_start
+data: {"type": "content_block_start", "index": 2, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 2, "delta": {"type": "input_json_delta", "partial_json": "{\"city\": "}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 2}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	for i := 0; i < 2; i++ {
+		_, err := decoder.Decode()
+		require.NoError(t, err)
+	}
+
+	_, err := decoder.Decode()
+	assert.ErrorContains(t, err, "content block 2: invalid tool input JSON")
+}
+
+func TestMessageSSEDecoder_UnknownEvent(t *testing.T) {
+	input := `event: content_block_future
+data: {"type": "content_block_future", "index": 0, "payload": {"a": 1}}
+
+event: message_stop
+data: {"type": "message_stop"}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	event, err := decoder.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "content_block_future", event.Event)
+	unknown, ok := event.Data.Data.(UnknownEvent)
+	require.True(t, ok)
+	assert.Equal(t, "content_block_future", unknown.Type)
+	assert.JSONEq(t, `{"type": "content_block_future", "index": 0, "payload": {"a": 1}}`, string(unknown.Data))
+
+	event, err = decoder.Decode()
+	require.NoError(t, err)
+	assert.IsType(t, MessageStopData{}, event.Data.Data)
+}
+
+func TestMessageSSEDecoder_TypeSwitch(t *testing.T) {
+	decoder := NewMessageSSEDecoder(strings.NewReader(accumulatorStream))
+
+	var (
+		message    MessageResponse
+		blockTypes []string
+		text       strings.Builder
+		stop       StopDelta
+		counts     = map[string]int{}
+	)
+	for {
+		payload, err := decoder.Decode()
+		require.NoError(t, err)
+		if payload == nil {
+			break
+		}
+
+		switch event := payload.Data.Data.(type) {
+		case MessageStart:
+			message = event.Message
+		case ContentBlockStart:
+			blockTypes = append(blockTypes, event.ContentBlock.Type)
+		case ContentBlockDelta:
+			text.WriteString(event.Delta.Text)
+		case ContentBlockStop:
+			counts["stop"]++
+		case MessageDelta:
+			stop = event.Delta
+			message.Usage.OutputTokens = event.Usage.OutputTokens
+		case MessageStopData:
+			counts["message_stop"]++
+		case PingData:
+			counts["ping"]++
+		case UnknownEvent:
+			t.Fatalf("unexpected event %s", event.Type)
+		}
+	}
+
+	assert.Equal(t, "msg_1", message.ID)
+	assert.Equal(t, RoleTypeAssistant, message.Role)
+	assert.Equal(t, Usage{InputTokens: 25, OutputTokens: 42, CacheReadInputTokens: 10}, message.Usage)
+	assert.Equal(t, []string{"thinking", "text", "tool_use"}, blockTypes)
+	assert.Equal(t, "Go is fast.", text.String())
+	assert.Equal(t, StopDelta{StopReason: "tool_use"}, stop)
+	assert.Equal(t, map[string]int{"stop": 3, "message_stop": 1, "ping": 1}, counts)
+}
@@ -0,0 +1,151 @@
+package anthrogo
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// MessageStream is the response of MessageStreamRequest. It owns the response body and the
+// context of the request, and decodes the events as they arrive.
+//
+//	stream, err := client.MessageStreamRequest(ctx, payload)
+//	if err != nil {
+//		...
+//	}
+//	defer stream.Close()
+//
+//	for stream.Next() {
+//		event := stream.Current()
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+//
+// The stream is closed when Next returns false, so Close is only needed when the stream is
+// abandoned early; calling it again is harmless. Close may be called from another goroutine
+// to abort a stream that Next is waiting on.
+type MessageStream struct {
+	decoder *MessageSSEDecoder
+	options DecodeOptions
+	body    io.ReadCloser
+	cancel  context.CancelFunc
+
+	current *MessageEventPayload
+	err     error
+
+	closeOnce sync.Once
+	closed    atomic.Bool
+	closeErr  error
+}
+
+func newMessageStream(body io.ReadCloser, cancel context.CancelFunc, options DecodeOptions) *MessageStream {
+	return &MessageStream{
+		decoder: NewMessageSSEDecoder(body),
+		options: options,
+		body:    body,
+		cancel:  cancel,
+	}
+}
+
+// Next advances to the next event. It returns false when the stream ended, an error
+// occurred or the stream was closed, after which the stream is closed.
+func (s *MessageStream) Next() bool {
+	if s.closed.Load() || s.err != nil {
+		return false
+	}
+
+	event, err := s.decoder.Decode(s.options)
+	if err != nil {
+		// reading fails once the stream is closed, which is not an error of the stream
+		if !s.closed.Load() {
+			s.err = err
+		}
+		s.Close()
+		return false
+	}
+	if event == nil {
+		s.Close()
+		return false
+	}
+
+	s.current = event
+	return true
+}
+
+// Current returns the event Next advanced to.
+func (s *MessageStream) Current() *MessageEventPayload {
+	return s.current
+}
+
+// Err returns the error that stopped the stream, if any. Errors sent by the API in the
+// stream are returned here too.
+func (s *MessageStream) Err() error {
+	return s.err
+}
+
+// Events returns an iterator over the events of the stream, for use with range:
+//
+//	for event, err := range stream.Events() {
+//		if err != nil {
+//			...
+//		}
+//	}
+//
+// The error that stopped the stream is yielded last, with a nil event. The stream is closed
+// when the loop ends, including when it is left early with break.
+func (s *MessageStream) Events() iter.Seq2[*MessageEventPayload, error] {
+	return func(yield func(*MessageEventPayload, error) bool) {
+		defer s.Close()
+
+		for s.Next() {
+			if !yield(s.Current(), nil) {
+				return
+			}
+		}
+		if s.err != nil {
+			yield(nil, s.err)
+		}
+	}
+}
+
+// Text returns an iterator over the text deltas of the stream. The stream is closed when the
+// loop ends; Err reports whether it ended because of an error.
+func (s *MessageStream) Text() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		defer s.Close()
+
+		for s.Next() {
+			if text := s.Current().Data.Content; text != "" && !yield(text) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot returns the message received so far, see MessageAccumulator.Snapshot.
+func (s *MessageStream) Snapshot() MessageResponse {
+	return s.decoder.Accumulator().Snapshot()
+}
+
+// Final returns the complete message once Next returned false. It fails when the stream
+// ended early, see MessageAccumulator.Final.
+func (s *MessageStream) Final() (MessageResponse, error) {
+	if s.err != nil {
+		return s.Snapshot(), s.err
+	}
+	return s.decoder.Accumulator().Final()
+}
+
+// Close closes the response body and releases the context of the request. It returns the
+// error of the first call to Close on subsequent calls.
+func (s *MessageStream) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		s.closeErr = s.body.Close()
+		s.cancel()
+	})
+	return s.closeErr
+}
@@ -0,0 +1,203 @@
+package anthrogo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const streamStart = `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "content": [], "model": "claude-3-haiku-20240307", "usage": {"input_tokens": 10, "output_tokens": 1}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hi"}}
+
+`
+
+func streamPayload() MessagePayload {
+	return MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: conversation("hello")}
+}
+
+func TestMessageStream_Options(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart+"event: message_stop\ndata: {\"type\": \"message_stop\"}\n\n")
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload(), DecodeOptions{ContentOnly: true})
+	require.NoError(t, err)
+
+	var events []string
+	for stream.Next() {
+		events = append(events, stream.Current().Event)
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, []string{"content_block_delta", "message_stop"}, events)
+
+	// the stream closed itself when it ended
+	assert.NoError(t, stream.Close())
+	assert.NoError(t, stream.Close())
+
+	_, err = client.MessageStreamRequest(context.Background(), streamPayload(), DecodeOptions{}, DecodeOptions{})
+	assert.EqualError(t, err, "too many options provided, expected at most one")
+}
+
+func TestMessageStream_ErrorEvent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart+"event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+	defer stream.Close()
+
+	count := 0
+	for stream.Next() {
+		count++
+	}
+	assert.Equal(t, 4, count)
+	assert.EqualError(t, stream.Err(), "error(overloaded_error) -  Overloaded")
+	assert.False(t, stream.Next())
+}
+
+func TestMessageStream_CloseReleasesRequest(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart)
+		w.(http.Flusher).Flush()
+
+		// the model keeps generating until the client goes away
+		<-r.Context().Done()
+		close(done)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+
+	require.True(t, stream.Next())
+	assert.Equal(t, "message_start", stream.Current().Event)
+
+	assert.NoError(t, stream.Close())
+	assert.NoError(t, stream.Close())
+	assert.False(t, stream.Next())
+	assert.NoError(t, stream.Err())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not released by Close")
+	}
+}
+
+func TestMessageStream_CloseFromAnotherGoroutine(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+
+	count := 0
+	for stream.Next() {
+		count++
+		if count == 4 {
+			// the next event never comes, abort the stream while Next waits for it
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				stream.Close()
+			}()
+		}
+	}
+	assert.Equal(t, 4, count)
+	assert.NoError(t, stream.Err())
+}
+
+func TestMessageStream_Events(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart+"event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+
+	var events []string
+	var streamErr error
+	for event, err := range stream.Events() {
+		if err != nil {
+			assert.Nil(t, event)
+			streamErr = err
+			continue
+		}
+		events = append(events, event.Event)
+	}
+	assert.Equal(t, []string{"message_start", "content_block_start", "ping", "content_block_delta"}, events)
+	assert.EqualError(t, streamErr, "error(overloaded_error) -  Overloaded")
+}
+
+func TestMessageStream_Text(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, accumulatorStream)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+
+	var chunks []string
+	for text := range stream.Text() {
+		chunks = append(chunks, text)
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, []string{"Go is ", "fast."}, chunks)
+}
+
+func TestMessageStream_BreakReleasesRequest(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(done)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	stream, err := client.MessageStreamRequest(context.Background(), streamPayload())
+	require.NoError(t, err)
+
+	for text := range stream.Text() {
+		assert.Equal(t, "Hi", text)
+		break
+	}
+	assert.False(t, stream.Next())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not released when the loop ended")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -127,12 +126,17 @@ func TestClient_MessageStreamRequest(t *testing.T) {
 		{
 			name:         "successful request",
 			responseCode: http.StatusOK,
-			responseBody: `{"type": "stream_response", "content": [{"type": "text", "text": "Hello"}]}
-{"type": "stream_response", "content": [{"type": "text", "text": " world!"}]}
-[DONE]`,
-			expectedStream: `{"type": "stream_response", "content": [{"type": "text", "text": "Hello"}]}
-{"type": "stream_response", "content": [{"type": "text", "text": " world!"}]}
-[DONE]`,
+			responseBody: `event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hello"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": " world!"}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`,
+			expectedStream: "Hello world!",
 		},
 		{
 			name:          "error response",
@@ -187,26 +191,26 @@ func TestClient_MessageStreamRequest(t *testing.T) {
 				MaxTokens: 100,
 			}
 
-			body, cancel, err := client.MessageStreamRequest(ctx, payload)
-			defer func() {
-				if cancel != nil {
-					cancel()
-				}
-				if body != nil {
-					body.Close()
-				}
-			}()
+			stream, err := client.MessageStreamRequest(ctx, payload)
 
 			if tc.expectedError != "" {
 				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, stream)
 			} else {
 				require.NoError(t, err)
+				defer stream.Close()
 
 				var sb strings.Builder
-				_, err = io.Copy(&sb, body)
-				require.NoError(t, err)
+				var events []string
+				for stream.Next() {
+					events = append(events, stream.Current().Event)
+					sb.WriteString(stream.Current().Data.Content)
+				}
+				require.NoError(t, stream.Err())
 
 				assert.Equal(t, tc.expectedStream, sb.String())
+				assert.Equal(t, []string{"content_block_delta", "content_block_delta", "message_stop"}, events)
+				assert.False(t, stream.Next())
 			}
 		})
 	}
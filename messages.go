@@ -3,7 +3,7 @@ package anthrogo
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
 )
@@ -15,13 +15,28 @@ type ContentType string
 type RoleType string
 
 const (
-	ContentTypeText  ContentType = "text"
-	ContentTypeImage ContentType = "image"
+	ContentTypeText       ContentType = "text"
+	ContentTypeImage      ContentType = "image"
+	ContentTypeToolUse    ContentType = "tool_use"
+	ContentTypeToolResult ContentType = "tool_result"
+
+	ContentTypeThinking         ContentType = "thinking"
+	ContentTypeRedactedThinking ContentType = "redacted_thinking"
+
+	ContentTypeDocument ContentType = "document"
 
 	RoleTypeUser      RoleType = "user"
 	RoleTypeAssistant RoleType = "assistant"
 )
 
+// Stop reasons reported in MessageResponse.StopReason.
+const (
+	StopReasonEndTurn      = "end_turn"
+	StopReasonMaxTokens    = "max_tokens"
+	StopReasonStopSequence = "stop_sequence"
+	StopReasonToolUse      = "tool_use"
+)
+
 // MessagePayload is the request payload for the /messages endpoint.
 type MessagePayload struct {
 	// The model to use for the request.
@@ -42,8 +57,20 @@ type MessagePayload struct {
 	Metadata *Metadata `json:"metadata,omitempty"`
 	// System prompt to provide to the model.
 	System *string `json:"system,omitempty"`
+	// System prompt sent as text blocks, e.g. to mark it as a cache breakpoint. Takes the
+	// place of System when set.
+	SystemBlocks []MessageContent `json:"-"`
 	// Stream the response using server-sent events.
 	Stream *bool `json:"stream,omitempty"`
+	// Tools the model may use.
+	Tools []Tool `json:"tools,omitempty"`
+	// How the model should use the provided tools.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	// Extended thinking configuration.
+	Thinking *ThinkingConfig `json:"thinking,omitempty"`
+	// Automatic cache breakpoint placement for this request. Takes the place of the strategy
+	// set with WithAutoCache when set.
+	AutoCache *AutoCacheStrategy `json:"-"`
 }
 
 // Message is composed of a role and content. The role is either "user" or "assistant"
@@ -53,19 +80,109 @@ type Message struct {
 	Content []MessageContent `json:"content"`
 }
 
-// MessageContent is the content of a message. It can be either text or an image.
+// MessageContent is the content of a message. It can be text, an image, a document, a
+// tool_use block echoed back from the assistant or a tool_result block answering one.
+// Image and Document are both sent as the block's source.
 type MessageContent struct {
-	Type  ContentType  `json:"type,omitempty"`
-	Text  *string      `json:"text,omitempty"`
-	Image *ImageSource `json:"source,omitempty"`
+	Type     ContentType     `json:"type,omitempty"`
+	Text     *string         `json:"text,omitempty"`
+	Image    *ImageSource    `json:"-"`
+	Document *DocumentSource `json:"-"`
+
+	// Title, Context and Citations describe a document block.
+	Title     string           `json:"title,omitempty"`
+	Context   string           `json:"context,omitempty"`
+	Citations *CitationsConfig `json:"citations,omitempty"`
+
+	// CacheControl marks the block as a prompt-cache breakpoint.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+
+	// ID, Name and Input describe a tool_use block.
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// ToolUseID, Content and IsError describe a tool_result block. Content may
+	// hold text and image blocks.
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   []MessageContent `json:"content,omitempty"`
+	IsError   bool             `json:"is_error,omitempty"`
+
+	// Thinking and Signature describe a thinking block and Data a redacted_thinking block.
+	// They must be sent back unchanged.
+	Thinking  *string `json:"thinking,omitempty"`
+	Signature string  `json:"signature,omitempty"`
+	Data      string  `json:"data,omitempty"`
 }
 
-// ImageSource describes an image that is sent to the model in base64 (type).
+// MarshalJSON sends the Image or Document of the block as its source.
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	type alias MessageContent
+	out := struct {
+		alias
+		Source any `json:"source,omitempty"`
+	}{alias: alias(c)}
+
+	if c.Document != nil {
+		out.Source = c.Document
+	} else if c.Image != nil {
+		out.Source = c.Image
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads the source of the block into Image or Document depending on the
+// block type, and accepts tool_result content given as a plain string.
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	type alias MessageContent
+	aux := struct {
+		*alias
+		Source  json.RawMessage `json:"source,omitempty"`
+		Content json.RawMessage `json:"content,omitempty"`
+	}{alias: (*alias)(c)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	c.Image, c.Document, c.Content = nil, nil, nil
+	if len(aux.Source) > 0 && string(aux.Source) != "null" {
+		var err error
+		if c.Type == ContentTypeDocument {
+			err = json.Unmarshal(aux.Source, &c.Document)
+		} else {
+			err = json.Unmarshal(aux.Source, &c.Image)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(aux.Content) > 0 && aux.Content[0] == '"' {
+		var text string
+		if err := json.Unmarshal(aux.Content, &text); err != nil {
+			return err
+		}
+		c.Content = []MessageContent{NewTextContent(text)}
+	} else if len(aux.Content) > 0 && string(aux.Content) != "null" {
+		if err := json.Unmarshal(aux.Content, &c.Content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImageSource describes an image that is sent to the model in base64, by URL or as a file
+// uploaded through the Files API (type).
 // The following media types are accepted: image/jpeg, image/png, image/gif, image/webp.
 type ImageSource struct {
 	Type      string `json:"type"`
-	MediaType string `json:"media_type"`
-	Data      string `json:"data"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
 }
 
 // Metadata is an object describing metadata about the request.
@@ -86,30 +203,123 @@ type MessageResponse struct {
 	Usage        Usage          `json:"usage"`
 }
 
-// ContentBlock is a block of content in a message response.
-// Currently the model will only return text content.
+// ContentBlock is a block of content in a message response. Text blocks carry Text and the
+// Citations backing it, tool_use blocks carry the ID, Name and Input of the requested tool
+// call, thinking blocks carry Thinking and its Signature and redacted_thinking blocks carry
+// encrypted Data.
 type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Data      string          `json:"data,omitempty"`
+	Citations []Citation      `json:"citations,omitempty"`
 }
 
-// Usage contains information about the number of input and output tokens.
+// Usage contains information about the number of input and output tokens. Input tokens
+// written to or read from the prompt cache are counted separately from InputTokens.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int            `json:"input_tokens"`
+	OutputTokens             int            `json:"output_tokens"`
+	CacheCreationInputTokens int            `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int            `json:"cache_read_input_tokens,omitempty"`
+	CacheCreation            *CacheCreation `json:"cache_creation,omitempty"`
+}
+
+// add sums the token counts of other into u.
+func (u *Usage) add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+	if other.CacheCreation != nil {
+		if u.CacheCreation == nil {
+			u.CacheCreation = &CacheCreation{}
+		}
+		u.CacheCreation.Ephemeral5mInputTokens += other.CacheCreation.Ephemeral5mInputTokens
+		u.CacheCreation.Ephemeral1hInputTokens += other.CacheCreation.Ephemeral1hInputTokens
+	}
+}
+
+// MarshalJSON sends SystemBlocks as the system prompt when set and System otherwise.
+func (p MessagePayload) MarshalJSON() ([]byte, error) {
+	type alias MessagePayload
+	out := struct {
+		alias
+		System any `json:"system,omitempty"`
+	}{alias: alias(p)}
+
+	if len(p.SystemBlocks) > 0 {
+		out.System = p.SystemBlocks
+	} else if p.System != nil {
+		out.System = *p.System
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads a system prompt given either as a string or as a list of blocks.
+func (p *MessagePayload) UnmarshalJSON(data []byte) error {
+	type alias MessagePayload
+	aux := struct {
+		*alias
+		System json.RawMessage `json:"system,omitempty"`
+	}{alias: (*alias)(p)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	p.System, p.SystemBlocks = nil, nil
+	if len(aux.System) == 0 || string(aux.System) == "null" {
+		return nil
+	}
+	if aux.System[0] == '"' {
+		var system string
+		if err := json.Unmarshal(aux.System, &system); err != nil {
+			return err
+		}
+		p.System = &system
+		return nil
+	}
+
+	return json.Unmarshal(aux.System, &p.SystemBlocks)
 }
 
 // MessageRequest sends a message to the model and returns the response.
+// When the response StopReason is StopReasonToolUse the model is waiting on the
+// results of the blocks returned by ToolUses.
 func (c *Client) MessageRequest(ctx context.Context, payload MessagePayload) (MessageResponse, error) {
 	var resp MessageResponse
 	stream := false
 	payload.Stream = &stream
 
+	payload = c.applyAutoCache(payload)
+
+	if err := payload.validate(); err != nil {
+		return resp, err
+	}
+	if err := c.checkMessageModel(payload); err != nil {
+		return resp, err
+	}
+
+	if c.preflightTokenCheck {
+		if err := c.checkContextWindow(ctx, payload); err != nil {
+			return resp, err
+		}
+	}
+
 	req, cancel, err := c.createRequest(ctx, payload, RequestTypeMessages)
 	if err != nil {
 		return resp, err
 	}
 	defer cancel()
+	for _, opt := range payload.requestOptions() {
+		opt(req)
+	}
 
 	res, err := c.doRequestWithRetries(req)
 	if err != nil {
@@ -123,12 +333,7 @@ func (c *Client) MessageRequest(ctx context.Context, payload MessagePayload) (Me
 	}
 
 	if res.StatusCode != http.StatusOK {
-		var errorResponse ErrorResponse
-		err = json.Unmarshal(body, &errorResponse)
-		if err != nil {
-			return resp, fmt.Errorf("request failed and error response had unexpected form: %w", err)
-		}
-		return resp, fmt.Errorf("%s: %s", errorResponse.Error.Type, errorResponse.Error.Message)
+		return resp, newAPIError(res, body)
 	}
 
 	err = json.Unmarshal(body, &resp)
@@ -139,36 +344,76 @@ func (c *Client) MessageRequest(ctx context.Context, payload MessagePayload) (Me
 	return resp, nil
 }
 
-// MessageStreamRequest sends a message to the model and returns the body for the user to consume
-func (c *Client) MessageStreamRequest(ctx context.Context, payload MessagePayload) (io.ReadCloser, context.CancelFunc, error) {
+// MessageStreamRequest sends a message to the model and returns a stream of the events of the
+// response. The options are passed to the decoder of the stream, see DecodeOptions.
+func (c *Client) MessageStreamRequest(ctx context.Context, payload MessagePayload, opts ...DecodeOptions) (*MessageStream, error) {
+	var options DecodeOptions
+	if len(opts) > 1 {
+		return nil, errors.New("too many options provided, expected at most one")
+	} else if len(opts) == 1 {
+		options = opts[0]
+	}
+
 	stream := true
 	payload.Stream = &stream
 
+	payload = c.applyAutoCache(payload)
+
+	if err := payload.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.checkMessageModel(payload); err != nil {
+		return nil, err
+	}
+
+	if c.preflightTokenCheck {
+		if err := c.checkContextWindow(ctx, payload); err != nil {
+			return nil, err
+		}
+	}
+
 	req, cancel, err := c.createRequest(ctx, payload, RequestTypeMessages)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	for _, opt := range payload.requestOptions() {
+		opt(req)
 	}
 
 	res, err := c.doRequestWithRetries(req)
 	if err != nil {
-		return nil, nil, err
+		cancel()
+		return nil, err
 	}
 
 	if res.StatusCode != http.StatusOK {
-		var errorResponse ErrorResponse
+		defer res.Body.Close()
+		defer cancel()
 
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		err = json.Unmarshal(body, &errorResponse)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, nil, fmt.Errorf("%s: %s", errorResponse.Error.Type, errorResponse.Error.Message)
+		return nil, newAPIError(res, body)
 	}
 
-	return res.Body, cancel, nil
+	return newMessageStream(res.Body, cancel, options), nil
+}
+
+// validate checks the payload for combinations the API is known to reject.
+func (p MessagePayload) validate() error {
+	if p.System != nil && len(p.SystemBlocks) > 0 {
+		return errors.New("only one of System and SystemBlocks may be set")
+	}
+	if err := validateTools(p.Tools, p.ToolChoice); err != nil {
+		return err
+	}
+	if err := p.validateThinking(); err != nil {
+		return err
+	}
+	if err := p.validateSources(); err != nil {
+		return err
+	}
+	return p.validateCacheControl()
 }
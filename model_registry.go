@@ -0,0 +1,307 @@
+package anthrogo
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ModelCapabilities describes the limits and features of a model.
+type ModelCapabilities struct {
+	// ContextWindow is the largest number of input plus output tokens.
+	ContextWindow int
+	// MaxOutputTokens is the largest accepted max_tokens.
+	MaxOutputTokens int
+	// MinCacheableTokens is the shortest prompt prefix that can be cached. Zero stands for
+	// the minimum of most models, 1024 tokens.
+	MinCacheableTokens int
+
+	// Messages and Completions report support for the Messages API and the legacy Text
+	// Completions API.
+	Messages    bool
+	Completions bool
+
+	Vision   bool
+	Tools    bool
+	Thinking bool
+	PDF      bool
+
+	// DeprecatedAt is the date the deprecation of the model was announced and RetiredAt the
+	// date requests to it start failing. Both are zero for current models.
+	DeprecatedAt time.Time
+	RetiredAt    time.Time
+}
+
+// Deprecated reports whether the model is deprecated or retired at the given time.
+func (c ModelCapabilities) Deprecated(at time.Time) bool {
+	return !c.DeprecatedAt.IsZero() && !at.Before(c.DeprecatedAt)
+}
+
+// Retired reports whether the model is retired at the given time.
+func (c ModelCapabilities) Retired(at time.Time) bool {
+	return !c.RetiredAt.IsZero() && !at.Before(c.RetiredAt)
+}
+
+// ModelRegistry records the capabilities of models. It is safe for concurrent use, so models
+// released after this package can be registered at runtime.
+type ModelRegistry struct {
+	mu     sync.RWMutex
+	models map[AnthropicModel]ModelCapabilities
+}
+
+// DefaultModelRegistry is used by clients created without WithModelRegistry. It knows the
+// models declared by this package and the aliases of the current ones.
+var DefaultModelRegistry = NewModelRegistry()
+
+// NewModelRegistry returns a registry holding the models declared by this package and the
+// aliases of the current ones.
+func NewModelRegistry() *ModelRegistry {
+	r := &ModelRegistry{models: map[AnthropicModel]ModelCapabilities{}}
+	for model, capabilities := range builtinModels() {
+		r.models[model] = capabilities
+	}
+	return r
+}
+
+// Register adds a model or replaces its capabilities.
+func (r *ModelRegistry) Register(model AnthropicModel, capabilities ModelCapabilities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[model] = capabilities
+}
+
+// Lookup returns the capabilities of a model and whether it is known.
+func (r *ModelRegistry) Lookup(model AnthropicModel) (ModelCapabilities, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	capabilities, ok := r.models[model]
+	return capabilities, ok
+}
+
+// Models returns the known models in alphabetical order.
+func (r *ModelRegistry) Models() []AnthropicModel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	models := make([]AnthropicModel, 0, len(r.models))
+	for model := range r.models {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i] < models[j] })
+	return models
+}
+
+// WithModelRegistry is an option to check requests against the given registry instead of
+// DefaultModelRegistry.
+func WithModelRegistry(registry *ModelRegistry) func(*Client) {
+	return func(c *Client) {
+		c.models = registry
+	}
+}
+
+// WithLogger is an option to set the logger used for warnings, such as the use of a
+// deprecated model. It defaults to slog.Default().
+func WithLogger(logger *slog.Logger) func(*Client) {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// lookupModel returns the capabilities of a model from the registry of the client. It logs a
+// warning the first time the client uses a model that is not in the registry.
+func (c *Client) lookupModel(model AnthropicModel) (ModelCapabilities, bool) {
+	capabilities, ok := c.models.Lookup(model)
+	if !ok {
+		if _, warned := c.unknownModelWarnings.LoadOrStore(model, true); !warned {
+			c.logger.Warn("model is not in the registry and requests to it are not checked", "model", model)
+		}
+	}
+	return capabilities, ok
+}
+
+// checkMessageModel rejects payloads using features the model does not support. Models that
+// are not in the registry are not checked, see lookupModel.
+func (c *Client) checkMessageModel(payload MessagePayload) error {
+	capabilities, ok := c.lookupModel(payload.Model)
+	if !ok {
+		return nil
+	}
+	c.warnDeprecated(payload.Model, capabilities)
+
+	if !capabilities.Messages {
+		return fmt.Errorf("model %s does not support the Messages API", payload.Model)
+	}
+	if payload.MaxTokens > capabilities.MaxOutputTokens {
+		return fmt.Errorf("max_tokens (%d) exceeds the maximum output of %s (%d)", payload.MaxTokens, payload.Model, capabilities.MaxOutputTokens)
+	}
+	if len(payload.Tools) > 0 && !capabilities.Tools {
+		return fmt.Errorf("model %s does not support tools", payload.Model)
+	}
+	if payload.Thinking != nil && payload.Thinking.Type == ThinkingTypeEnabled && !capabilities.Thinking {
+		return fmt.Errorf("model %s does not support extended thinking", payload.Model)
+	}
+
+	for _, message := range payload.Messages {
+		for _, content := range message.Content {
+			if err := checkContentModel(payload.Model, capabilities, content); err != nil {
+				return err
+			}
+			for _, nested := range content.Content {
+				if err := checkContentModel(payload.Model, capabilities, nested); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkContentModel rejects images sent to text-only models and PDFs sent to models that
+// cannot read them.
+func checkContentModel(model AnthropicModel, capabilities ModelCapabilities, content MessageContent) error {
+	if content.Type == ContentTypeImage && !capabilities.Vision {
+		return fmt.Errorf("model %s does not support images", model)
+	}
+	if content.Type == ContentTypeDocument && content.Document != nil && !capabilities.PDF {
+		switch content.Document.Type {
+		case DocumentSourceBase64, DocumentSourceURL, DocumentSourceFile:
+			return fmt.Errorf("model %s does not support PDF documents", model)
+		}
+	}
+	return nil
+}
+
+// checkCompletionModel rejects models that do not support the Text Completions API.
+func (c *Client) checkCompletionModel(model AnthropicModel) error {
+	capabilities, ok := c.lookupModel(model)
+	if !ok {
+		return nil
+	}
+	c.warnDeprecated(model, capabilities)
+
+	if !capabilities.Completions {
+		return fmt.Errorf("model %s does not support the Text Completions API", model)
+	}
+	return nil
+}
+
+// warnDeprecated logs a warning the first time the client uses a deprecated model.
+func (c *Client) warnDeprecated(model AnthropicModel, capabilities ModelCapabilities) {
+	now := time.Now()
+	if !capabilities.Deprecated(now) {
+		return
+	}
+	if _, warned := c.deprecationWarnings.LoadOrStore(model, true); warned {
+		return
+	}
+
+	if capabilities.Retired(now) {
+		c.logger.Warn("model is retired and requests to it will fail", "model", model, "retired_at", capabilities.RetiredAt.Format(time.DateOnly))
+		return
+	}
+
+	attrs := []any{"model", model}
+	if !capabilities.RetiredAt.IsZero() {
+		attrs = append(attrs, "retires_at", capabilities.RetiredAt.Format(time.DateOnly))
+	}
+	c.logger.Warn("model is deprecated", attrs...)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// builtinModels returns the capabilities of the models declared by this package and of the
+// aliases of the current ones.
+func builtinModels() map[AnthropicModel]ModelCapabilities {
+	claude3 := ModelCapabilities{
+		ContextWindow:   200_000,
+		MaxOutputTokens: 4096,
+		Messages:        true,
+		Vision:          true,
+		Tools:           true,
+	}
+
+	claude4 := claude3
+	claude4.MaxOutputTokens = 64_000
+	claude4.Thinking = true
+	claude4.PDF = true
+
+	opus4 := claude4
+	opus4.MaxOutputTokens = 32_000
+
+	sonnet37 := claude4
+	sonnet37.DeprecatedAt, sonnet37.RetiredAt = date(2025, time.October, 28), date(2026, time.February, 19)
+
+	haiku45 := claude4
+	haiku45.MinCacheableTokens = 4096
+
+	opus45 := claude4
+	opus45.MinCacheableTokens = 4096
+
+	haiku35 := claude3
+	haiku35.MaxOutputTokens = 8192
+	haiku35.MinCacheableTokens = 2048
+	haiku35.PDF = true
+
+	haiku3 := claude3
+	haiku3.MinCacheableTokens = 2048
+
+	sonnet35 := claude3
+	sonnet35.MaxOutputTokens = 8192
+	sonnet35.PDF = true
+	sonnet35.DeprecatedAt, sonnet35.RetiredAt = date(2025, time.August, 13), date(2025, time.October, 22)
+
+	opus := claude3
+	opus.DeprecatedAt, opus.RetiredAt = date(2025, time.June, 30), date(2026, time.January, 5)
+
+	sonnet := claude3
+	sonnet.DeprecatedAt, sonnet.RetiredAt = date(2025, time.January, 21), date(2025, time.July, 21)
+
+	claude2 := ModelCapabilities{
+		ContextWindow:   100_000,
+		MaxOutputTokens: 4096,
+		Messages:        true,
+		Completions:     true,
+		DeprecatedAt:    date(2025, time.January, 21),
+		RetiredAt:       date(2025, time.July, 21),
+	}
+
+	claude21 := claude2
+	claude21.ContextWindow = 200_000
+
+	instant := ModelCapabilities{
+		ContextWindow:   100_000,
+		MaxOutputTokens: 4096,
+		Completions:     true,
+		DeprecatedAt:    date(2024, time.September, 4),
+		RetiredAt:       date(2024, time.November, 6),
+	}
+
+	return map[AnthropicModel]ModelCapabilities{
+		ModelClaudeOpus4Dot5:    opus45,
+		"claude-opus-4-5":       opus45,
+		ModelClaudeSonnet4Dot5:  claude4,
+		"claude-sonnet-4-5":     claude4,
+		ModelClaudeHaiku4Dot5:   haiku45,
+		"claude-haiku-4-5":      haiku45,
+		ModelClaudeOpus4Dot1:    opus4,
+		"claude-opus-4-1":       opus4,
+		ModelClaudeOpus4:        opus4,
+		"claude-opus-4-0":       opus4,
+		ModelClaudeSonnet4:      claude4,
+		"claude-sonnet-4-0":     claude4,
+		ModelClaude3Dot7Sonnet:  sonnet37,
+		ModelClaude3Dot5Haiku:   haiku35,
+		ModelClaude3Dot5Sonnet:  sonnet35,
+		ModelClaude3Opus:        opus,
+		ModelClaude3Sonnet:      sonnet,
+		ModelClaude3Haiku:       haiku3,
+		ModelClaude2:            claude2,
+		ModelClaude2Dot1:        claude21,
+		ModelClaudeInstant1Dot2: instant,
+	}
+}
@@ -0,0 +1,226 @@
+package anthrogo
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRegistry(t *testing.T) {
+	registry := NewModelRegistry()
+
+	capabilities, ok := registry.Lookup(ModelClaude3Haiku)
+	require.True(t, ok)
+	assert.Equal(t, 200_000, capabilities.ContextWindow)
+	assert.True(t, capabilities.Vision)
+	assert.False(t, capabilities.Completions)
+
+	capabilities, ok = registry.Lookup(ModelClaudeInstant1Dot2)
+	require.True(t, ok)
+	assert.True(t, capabilities.Retired(time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, capabilities.Deprecated(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)))
+
+	capabilities, ok = registry.Lookup("claude-sonnet-4-5")
+	require.True(t, ok)
+	assert.Equal(t, 64_000, capabilities.MaxOutputTokens)
+	assert.True(t, capabilities.Thinking)
+	assert.False(t, capabilities.Deprecated(time.Now()))
+
+	_, ok = registry.Lookup("claude-future")
+	assert.False(t, ok)
+
+	registry.Register("claude-future", ModelCapabilities{ContextWindow: 1_000_000, Messages: true})
+	capabilities, ok = registry.Lookup("claude-future")
+	require.True(t, ok)
+	assert.Equal(t, 1_000_000, capabilities.ContextWindow)
+	assert.Len(t, registry.Models(), 22)
+	assert.Equal(t, AnthropicModel("claude-2.0"), registry.Models()[0])
+
+	// registries are independent
+	_, ok = DefaultModelRegistry.Lookup("claude-future")
+	assert.False(t, ok)
+}
+
+func TestClient_MessageRequestModelCapabilities(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer ts.Close()
+
+	registry := NewModelRegistry()
+	registry.Register("claude-thinker", ModelCapabilities{ContextWindow: 200_000, MaxOutputTokens: 64_000, Messages: true, Thinking: true})
+
+	client, err := NewClient(WithApiKey("fake-key"), WithModelRegistry(registry), WithLogger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))))
+	require.NoError(t, err)
+	client.baseURL = ts.URL + "/"
+
+	withContent := func(content MessageContent) []Message {
+		return []Message{{Role: RoleTypeUser, Content: []MessageContent{content}}}
+	}
+
+	testCases := []struct {
+		name          string
+		payload       MessagePayload
+		expectedError string
+	}{
+		{
+			name:          "completions only model",
+			payload:       MessagePayload{Model: ModelClaudeInstant1Dot2, MaxTokens: 10, Messages: conversation("hi")},
+			expectedError: "model claude-instant-1.2 does not support the Messages API",
+		},
+		{
+			name:          "image to text only model",
+			payload:       MessagePayload{Model: ModelClaude2Dot1, MaxTokens: 10, Messages: withContent(NewImageContent(NewURLImageSource("https://cdn.example.com/cat.jpg")))},
+			expectedError: "model claude-2.1 does not support images",
+		},
+		{
+			name: "image in tool result",
+			payload: MessagePayload{Model: ModelClaude2, MaxTokens: 10, Messages: withContent(
+				NewToolResultContent("t", NewImageContent(NewFileImageSource("file_1"))),
+			)},
+			expectedError: "model claude-2.0 does not support images",
+		},
+		{
+			name:          "pdf",
+			payload:       MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: withContent(NewDocumentContent(NewPDFDocumentSource([]byte("%PDF")), "", false))},
+			expectedError: "model claude-3-haiku-20240307 does not support PDF documents",
+		},
+		{
+			name:    "text document",
+			payload: MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 10, Messages: withContent(NewDocumentContent(NewTextDocumentSource("notes"), "", false))},
+		},
+		{
+			name: "tools",
+			payload: MessagePayload{Model: ModelClaude2, MaxTokens: 10, Messages: conversation("hi"),
+				Tools: []Tool{{Name: "a", InputSchema: map[string]any{"type": "object"}}}},
+			expectedError: "model claude-2.0 does not support tools",
+		},
+		{
+			name:          "thinking",
+			payload:       MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 4000, Messages: conversation("hi"), Thinking: NewThinkingConfig(2048)},
+			expectedError: "model claude-3-haiku-20240307 does not support extended thinking",
+		},
+		{
+			name:          "max tokens",
+			payload:       MessagePayload{Model: ModelClaude3Haiku, MaxTokens: 8192, Messages: conversation("hi")},
+			expectedError: "max_tokens (8192) exceeds the maximum output of claude-3-haiku-20240307 (4096)",
+		},
+		{
+			name:    "registered model",
+			payload: MessagePayload{Model: "claude-thinker", MaxTokens: 32_000, Messages: conversation("hi"), Thinking: NewThinkingConfig(16_000)},
+		},
+		{
+			name:    "unknown model",
+			payload: MessagePayload{Model: "claude-unknown", MaxTokens: 100_000, Messages: conversation("hi"), Thinking: NewThinkingConfig(2048)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = 0
+			_, err := client.MessageRequest(context.Background(), tc.payload)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Equal(t, 0, calls)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, calls)
+			}
+		})
+	}
+}
+
+func TestClient_CompletionRequestModelCapabilities(t *testing.T) {
+	client, err := NewClient(WithApiKey("fake-key"), WithLogger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))))
+	require.NoError(t, err)
+
+	_, err = client.CompletionRequest(context.Background(), CompletionPayload{Model: ModelClaude3Haiku, Prompt: "\n\nHuman: hi\n\nAssistant:"})
+	assert.EqualError(t, err, "model claude-3-haiku-20240307 does not support the Text Completions API")
+
+	_, err = client.StreamingCompletionRequest(context.Background(), CompletionPayload{Model: ModelClaude3Opus})
+	assert.EqualError(t, err, "model claude-3-opus-20240229 does not support the Text Completions API")
+}
+
+func TestClient_DeprecationWarning(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer ts.Close()
+
+	registry := NewModelRegistry()
+	registry.Register("claude-old", ModelCapabilities{
+		ContextWindow:   200_000,
+		MaxOutputTokens: 4096,
+		Messages:        true,
+		DeprecatedAt:    time.Now().Add(-24 * time.Hour),
+		RetiredAt:       time.Date(2999, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	registry.Register("claude-undated", ModelCapabilities{
+		ContextWindow:   200_000,
+		MaxOutputTokens: 4096,
+		Messages:        true,
+		DeprecatedAt:    time.Now().Add(-24 * time.Hour),
+	})
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	client, err := NewClient(WithApiKey("fake-key"), WithModelRegistry(registry), WithLogger(logger))
+	require.NoError(t, err)
+	client.baseURL = ts.URL + "/"
+
+	for i := 0; i < 2; i++ {
+		_, err = client.MessageRequest(context.Background(), MessagePayload{Model: "claude-old", MaxTokens: 10, Messages: conversation("hi")})
+		require.NoError(t, err)
+	}
+
+	_, err = client.MessageRequest(context.Background(), MessagePayload{Model: "claude-undated", MaxTokens: 10, Messages: conversation("hi")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "level=WARN msg=\"model is deprecated\" model=claude-old retires_at=2999-01-01\n"+
+		"level=WARN msg=\"model is deprecated\" model=claude-undated\n", logs.String())
+}
+
+func TestClient_UnknownModelWarning(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	client, err := NewClient(WithApiKey("fake-key"), WithLogger(logger))
+	require.NoError(t, err)
+	client.baseURL = ts.URL + "/"
+
+	for _, model := range []AnthropicModel{"claude-unknown", "claude-unknown", ModelClaudeSonnet4Dot5} {
+		_, err = client.MessageRequest(context.Background(), MessagePayload{Model: model, MaxTokens: 10, Messages: conversation("hi")})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "level=WARN msg=\"model is not in the registry and requests to it are not checked\" model=claude-unknown\n", logs.String())
+}
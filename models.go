@@ -0,0 +1,137 @@
+package anthrogo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const RequestTypeModels = "models"
+
+// ModelInfo describes a model available through the API.
+type ModelInfo struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListModels returns a page of the available models, most recently released first.
+func (c *Client) ListModels(ctx context.Context, opts ListOptions) (Page[ModelInfo], error) {
+	var page Page[ModelInfo]
+	err := c.doJSON(ctx, http.MethodGet, withQuery(RequestTypeModels, opts.values()), nil, &page)
+	return page, err
+}
+
+// IterateModels returns an iterator over all the available models.
+func (c *Client) IterateModels(ctx context.Context, opts ListOptions) *PageIterator[ModelInfo] {
+	return newPageIterator(ctx, opts, c.ListModels)
+}
+
+// GetModel returns a model by ID. The API also accepts aliases such as
+// "claude-3-5-sonnet-latest" and returns the model they point to.
+func (c *Client) GetModel(ctx context.Context, id string) (ModelInfo, error) {
+	var model ModelInfo
+	err := c.doJSON(ctx, http.MethodGet, RequestTypeModels+"/"+url.PathEscape(id), nil, &model)
+	return model, err
+}
+
+// ResolveModel returns the most recent model matching a loose description such as
+// "latest sonnet", "haiku 3.5" or "opus", so that callers do not depend on the constants
+// of this package being up to date. The words of the description, apart from "latest" and
+// "claude", must all appear in the ID of the model; version numbers may be written with a
+// dot or a dash and must match the whole version, so "sonnet 3" does not match Sonnet 3.5.
+// A description that is the ID of a model resolves to that model.
+func (c *Client) ResolveModel(ctx context.Context, description string) (AnthropicModel, error) {
+	terms := modelTerms(description)
+	if len(terms) == 0 {
+		return "", fmt.Errorf("model description %q has no terms", description)
+	}
+
+	var best *ModelInfo
+	it := c.IterateModels(ctx, ListOptions{Limit: 1000})
+	for it.Next() {
+		model := it.Current()
+		if model.ID == strings.TrimSpace(description) {
+			return AnthropicModel(model.ID), nil
+		}
+		if !matchesModelTerms(model.ID, terms) {
+			continue
+		}
+		if best == nil || model.CreatedAt.After(best.CreatedAt) {
+			best = &model
+		}
+	}
+	if err := it.Err(); err != nil {
+		return "", err
+	}
+
+	if best == nil {
+		return "", fmt.Errorf("no model matches %q", description)
+	}
+	return AnthropicModel(best.ID), nil
+}
+
+// modelTerms splits a model description into lists of ID segments, e.g. "latest Sonnet 3.5"
+// into [["sonnet"], ["3", "5"]].
+func modelTerms(description string) [][]string {
+	var terms [][]string
+	for _, word := range strings.Fields(strings.ToLower(description)) {
+		if word == "latest" || word == "claude" {
+			continue
+		}
+		terms = append(terms, strings.FieldsFunc(word, func(r rune) bool { return r == '.' || r == '-' }))
+	}
+	return terms
+}
+
+// matchesModelTerms reports whether each term appears in the ID. Version terms, made of
+// numbers only, must be the whole version of the model, so that "sonnet 3" does not match
+// claude-3-5-sonnet; other terms must appear as consecutive segments of the ID.
+func matchesModelTerms(id string, terms [][]string) bool {
+	segments := strings.Split(strings.ToLower(id), "-")
+
+	var version []string
+	for _, segment := range segments {
+		if isVersionSegment(segment) {
+			version = append(version, segment)
+		}
+	}
+
+	for _, term := range terms {
+		if slices.IndexFunc(term, func(part string) bool { return !isVersionSegment(part) }) < 0 {
+			if !slices.Equal(term, version) {
+				return false
+			}
+			continue
+		}
+
+		found := false
+		for i := 0; i+len(term) <= len(segments) && !found; i++ {
+			found = slices.Equal(segments[i:i+len(term)], term)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isVersionSegment reports whether a segment of a model ID is part of its version number,
+// as opposed to its name or its date.
+func isVersionSegment(segment string) bool {
+	if segment == "" || len(segment) >= 8 {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package anthrogo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelsServer serves a model list split in pages of two.
+func modelsServer(t *testing.T) *httptest.Server {
+	pages := map[string]string{
+		"": `{"data": [
+			{"type": "model", "id": "claude-sonnet-4-20250514", "display_name": "Claude Sonnet 4", "created_at": "2025-05-22T00:00:00Z"},
+			{"type": "model", "id": "claude-3-7-sonnet-20250219", "display_name": "Claude Sonnet 3.7", "created_at": "2025-02-24T00:00:00Z"}
+		], "has_more": true, "first_id": "claude-sonnet-4-20250514", "last_id": "claude-3-7-sonnet-20250219"}`,
+		"claude-3-7-sonnet-20250219": `{"data": [
+			{"type": "model", "id": "claude-3-5-haiku-20241022", "display_name": "Claude Haiku 3.5", "created_at": "2024-10-22T00:00:00Z"},
+			{"type": "model", "id": "claude-3-5-sonnet-20241022", "display_name": "Claude Sonnet 3.5 (New)", "created_at": "2024-10-22T00:00:00Z"}
+		], "has_more": true, "first_id": "claude-3-5-haiku-20241022", "last_id": "claude-3-5-sonnet-20241022"}`,
+		"claude-3-5-sonnet-20241022": `{"data": [
+			{"type": "model", "id": "claude-3-haiku-20240307", "display_name": "Claude Haiku 3", "created_at": "2024-03-07T00:00:00Z"}
+		], "has_more": false, "first_id": "claude-3-haiku-20240307", "last_id": "claude-3-haiku-20240307"}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/models":
+			page, ok := pages[r.URL.Query().Get("after_id")]
+			require.True(t, ok)
+			w.Write([]byte(page))
+		case "/models/claude-3-5-sonnet-latest":
+			w.Write([]byte(`{"type": "model", "id": "claude-3-5-sonnet-20241022", "display_name": "Claude Sonnet 3.5 (New)", "created_at": "2024-10-22T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": {"type": "not_found_error", "message": "model not found"}}`))
+		}
+	}))
+}
+
+func TestClient_ListModels(t *testing.T) {
+	ts := modelsServer(t)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	page, err := client.ListModels(context.Background(), ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "Claude Sonnet 4", page.Data[0].DisplayName)
+	assert.Equal(t, 2025, page.Data[0].CreatedAt.Year())
+	assert.True(t, page.HasMore)
+
+	var ids []string
+	it := client.IterateModels(context.Background(), ListOptions{})
+	for it.Next() {
+		ids = append(ids, it.Current().ID)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{
+		"claude-sonnet-4-20250514",
+		"claude-3-7-sonnet-20250219",
+		"claude-3-5-haiku-20241022",
+		"claude-3-5-sonnet-20241022",
+		"claude-3-haiku-20240307",
+	}, ids)
+}
+
+func TestClient_GetModel(t *testing.T) {
+	ts := modelsServer(t)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	model, err := client.GetModel(context.Background(), "claude-3-5-sonnet-latest")
+	require.NoError(t, err)
+	assert.Equal(t, "claude-3-5-sonnet-20241022", model.ID)
+
+	_, err = client.GetModel(context.Background(), "claude-1")
+	assert.EqualError(t, err, "not_found_error: model not found")
+}
+
+func TestClient_ResolveModel(t *testing.T) {
+	ts := modelsServer(t)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	testCases := []struct {
+		description   string
+		expected      AnthropicModel
+		expectedError string
+	}{
+		{description: "latest sonnet", expected: "claude-sonnet-4-20250514"},
+		{description: "Sonnet 3.5", expected: "claude-3-5-sonnet-20241022"},
+		{description: "claude haiku", expected: "claude-3-5-haiku-20241022"},
+		{description: "haiku 3", expected: "claude-3-haiku-20240307"},
+		{description: "sonnet 3.7", expected: "claude-3-7-sonnet-20250219"},
+		{description: "sonnet 4", expected: "claude-sonnet-4-20250514"},
+		{description: "sonnet 3", expectedError: `no model matches "sonnet 3"`},
+		{description: "claude-3-haiku-20240307", expected: "claude-3-haiku-20240307"},
+		{description: "opus", expectedError: `no model matches "opus"`},
+		{description: "latest", expectedError: `model description "latest" has no terms`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			model, err := client.ResolveModel(context.Background(), tc.description)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, model)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package anthrogo
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// ListOptions selects a page of a list endpoint. Lists are ordered from newest to oldest;
+// AfterID returns the items following the given ID and BeforeID the items preceding it.
+type ListOptions struct {
+	// Limit is the number of items per page, between 1 and 1000. It defaults to 20.
+	Limit    int
+	BeforeID string
+	AfterID  string
+}
+
+// values returns the query parameters of the options.
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.BeforeID != "" {
+		values.Set("before_id", o.BeforeID)
+	}
+	if o.AfterID != "" {
+		values.Set("after_id", o.AfterID)
+	}
+	return values
+}
+
+// withQuery appends the query parameters to path.
+func withQuery(path string, values url.Values) string {
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+// Page is a page of a list endpoint.
+type Page[T any] struct {
+	Data    []T    `json:"data"`
+	HasMore bool   `json:"has_more"`
+	FirstID string `json:"first_id"`
+	LastID  string `json:"last_id"`
+}
+
+// PageIterator walks through all the items of a list endpoint, fetching pages as needed.
+//
+//	it := client.IterateMessageBatches(ctx, ListOptions{})
+//	for it.Next() {
+//		batch := it.Current()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type PageIterator[T any] struct {
+	ctx     context.Context
+	fetch   func(ctx context.Context, opts ListOptions) (Page[T], error)
+	opts    ListOptions
+	page    Page[T]
+	index   int
+	fetched bool
+	err     error
+}
+
+// newPageIterator returns an iterator starting at the page selected by opts. When
+// opts.BeforeID is set the iterator walks towards newer items.
+func newPageIterator[T any](ctx context.Context, opts ListOptions, fetch func(ctx context.Context, opts ListOptions) (Page[T], error)) *PageIterator[T] {
+	return &PageIterator[T]{ctx: ctx, fetch: fetch, opts: opts}
+}
+
+// Next advances to the next item, fetching the next page when the current one is
+// exhausted. It returns false when there are no more items or an error occurred.
+func (it *PageIterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for it.index+1 >= len(it.page.Data) {
+		if it.fetched && !it.page.HasMore {
+			return false
+		}
+
+		if it.fetched {
+			if it.opts.BeforeID != "" {
+				it.opts.BeforeID = it.page.FirstID
+			} else {
+				it.opts.AfterID = it.page.LastID
+			}
+		}
+
+		page, err := it.fetch(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index, it.fetched = page, -1, true
+
+		if len(page.Data) == 0 {
+			return false
+		}
+	}
+
+	it.index++
+	return true
+}
+
+// Current returns the item Next advanced to.
+func (it *PageIterator[T]) Current() T {
+	return it.page.Data[it.index]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *PageIterator[T]) Err() error {
+	return it.err
+}
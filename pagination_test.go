@@ -0,0 +1,80 @@
+package anthrogo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListOptions_Values(t *testing.T) {
+	assert.Equal(t, "messages/batches", withQuery("messages/batches", ListOptions{}.values()))
+	assert.Equal(t, "messages/batches?after_id=b&before_id=a&limit=10",
+		withQuery("messages/batches", ListOptions{Limit: 10, BeforeID: "a", AfterID: "b"}.values()))
+}
+
+func TestPageIterator(t *testing.T) {
+	items := []string{"1", "2", "3", "4", "5"}
+
+	// fetch serves items after opts.AfterID, two at a time
+	var requests []ListOptions
+	fetch := func(ctx context.Context, opts ListOptions) (Page[string], error) {
+		requests = append(requests, opts)
+
+		start := 0
+		if opts.AfterID != "" {
+			n, err := strconv.Atoi(opts.AfterID)
+			require.NoError(t, err)
+			start = n
+		}
+		end := min(start+2, len(items))
+
+		return Page[string]{
+			Data:    items[start:end],
+			HasMore: end < len(items),
+			FirstID: items[start],
+			LastID:  items[end-1],
+		}, nil
+	}
+
+	it := newPageIterator(context.Background(), ListOptions{Limit: 2}, fetch)
+	var got []string
+	for it.Next() {
+		got = append(got, it.Current())
+	}
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, items, got)
+	assert.Equal(t, []ListOptions{{Limit: 2}, {Limit: 2, AfterID: "2"}, {Limit: 2, AfterID: "4"}}, requests)
+	assert.False(t, it.Next())
+}
+
+func TestPageIterator_Error(t *testing.T) {
+	calls := 0
+	it := newPageIterator(context.Background(), ListOptions{}, func(ctx context.Context, opts ListOptions) (Page[int], error) {
+		calls++
+		if calls == 2 {
+			return Page[int]{}, errors.New("boom")
+		}
+		return Page[int]{Data: []int{1}, HasMore: true, LastID: "1"}, nil
+	})
+
+	assert.True(t, it.Next())
+	assert.Equal(t, 1, it.Current())
+	assert.False(t, it.Next())
+	assert.EqualError(t, it.Err(), "boom")
+	assert.False(t, it.Next())
+	assert.Equal(t, 2, calls)
+}
+
+func TestPageIterator_Empty(t *testing.T) {
+	it := newPageIterator(context.Background(), ListOptions{}, func(ctx context.Context, opts ListOptions) (Page[int], error) {
+		return Page[int]{HasMore: true}, nil
+	})
+
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
@@ -0,0 +1,516 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// PartialJSON is the best-effort value of a JSON document that may still be incomplete.
+// Open strings, arrays and objects are closed, truncated numbers and literals are kept
+// when they can be read, and object keys whose value has not started are dropped.
+type PartialJSON struct {
+	// Value is the decoded document using the same types as encoding/json decodes into an any.
+	// The values that were complete are shared with later results and must not be modified.
+	Value any
+	// Complete reports whether the whole document has been received.
+	Complete bool
+	// Incomplete lists the paths of values that were cut off, outermost first, using
+	// dotted keys and [index] for array elements (e.g. "items[2].name"). The document
+	// itself is reported through Complete rather than listed here.
+	Incomplete []string
+}
+
+// Map returns the value as an object, or nil if the document is not an object.
+func (p PartialJSON) Map() map[string]any {
+	m, _ := p.Value.(map[string]any)
+	return m
+}
+
+// IsIncomplete reports whether the value at path is still being received.
+func (p PartialJSON) IsIncomplete(path string) bool {
+	if path == "" {
+		return !p.Complete
+	}
+	for _, incomplete := range p.Incomplete {
+		if incomplete == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode fills v, usually a pointer to a struct, with the fields received so far.
+func (p PartialJSON) Decode(v any) error {
+	data, err := json.Marshal(p.Value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// PartialJSONParser parses a JSON document fragment by fragment, such as the partial_json of
+// input_json_delta events or the text deltas of a JSON answer. The parser keeps its state
+// between fragments, so each byte is read once; each result then costs a copy of the objects
+// and arrays that are still open.
+type PartialJSONParser struct {
+	raw strings.Builder
+	// parsed is the number of bytes of raw that were parsed.
+	parsed int
+	err    error
+
+	state partialState
+	// stack holds the open objects and arrays, outermost first.
+	stack  []*partialContainer
+	scalar partialScalar
+	root   any
+}
+
+// partialState is what the parser expects next, when no scalar is being read.
+type partialState int
+
+const (
+	partialValue partialState = iota
+	partialValueOrClose
+	partialKey
+	partialKeyOrClose
+	partialColon
+	partialCommaOrClose
+	partialDone
+)
+
+// partialContainer is an object or array that is still open.
+type partialContainer struct {
+	path    string
+	isArray bool
+	array   []any
+	object  map[string]any
+	// key is the key of the value being read in an object.
+	key string
+}
+
+// Kinds of partialScalar.
+const (
+	scalarString  = '"'
+	scalarNumber  = '0'
+	scalarLiteral = 't'
+)
+
+// partialScalar is the string, number or literal being read.
+type partialScalar struct {
+	kind  byte
+	path  string
+	start int
+	buf   strings.Builder
+
+	// key reports whether the string is an object key.
+	key bool
+	// escape holds the escape sequence being read, from its backslash.
+	escape []byte
+	// high is a high surrogate waiting for its low half.
+	high rune
+
+	literal string
+	value   any
+}
+
+// NewPartialJSONParser creates a new PartialJSONParser.
+func NewPartialJSONParser() *PartialJSONParser {
+	return &PartialJSONParser{}
+}
+
+// Feed appends a fragment and returns the best-effort value of everything received so far.
+// A number at the end of the fragments is reported as incomplete, as the next fragment may
+// continue it.
+func (p *PartialJSONParser) Feed(fragment string) (PartialJSON, error) {
+	p.write(fragment)
+	if err := p.advance(); err != nil {
+		return PartialJSON{}, err
+	}
+	return p.result(false)
+}
+
+// String returns the raw text received so far.
+func (p *PartialJSONParser) String() string {
+	return p.raw.String()
+}
+
+// write appends a fragment that is parsed by the next call to Feed.
+func (p *PartialJSONParser) write(fragment string) {
+	p.raw.WriteString(fragment)
+}
+
+// ParsePartialJSON parses a JSON document that may be cut off at any point. It returns an
+// error only when the text received so far can not be the start of a valid document.
+func ParsePartialJSON(s string) (PartialJSON, error) {
+	var parser PartialJSONParser
+	parser.write(s)
+	if err := parser.advance(); err != nil {
+		return PartialJSON{}, err
+	}
+	return parser.result(true)
+}
+
+// advance parses the bytes received since the last call. Errors are kept, as the document
+// can not become valid again.
+func (p *PartialJSONParser) advance() error {
+	if p.err != nil {
+		return p.err
+	}
+
+	input := p.raw.String()
+	for ; p.parsed < len(input); p.parsed++ {
+		if err := p.step(input[p.parsed]); err != nil {
+			p.err = err
+			return err
+		}
+	}
+
+	return nil
+}
+
+// step parses the byte at offset p.parsed.
+func (p *PartialJSONParser) step(c byte) error {
+	switch p.scalar.kind {
+	case scalarString:
+		return p.stepString(c)
+	case scalarLiteral:
+		return p.stepLiteral(c)
+	case scalarNumber:
+		if strings.IndexByte("+-0123456789.eE", c) >= 0 {
+			p.scalar.buf.WriteByte(c)
+			return nil
+		}
+		if err := p.endNumber(); err != nil {
+			return err
+		}
+	}
+
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		return nil
+	}
+
+	switch p.state {
+	case partialValue, partialValueOrClose:
+		if c == ']' && p.state == partialValueOrClose {
+			return p.closeContainer()
+		}
+		return p.startValue(c)
+	case partialKey, partialKeyOrClose:
+		if c == '}' && p.state == partialKeyOrClose {
+			return p.closeContainer()
+		}
+		if c != '"' {
+			return fmt.Errorf("expected object key at offset %d", p.parsed)
+		}
+		p.scalar = partialScalar{kind: scalarString, key: true}
+	case partialColon:
+		if c != ':' {
+			return fmt.Errorf("expected ':' after object key at offset %d", p.parsed)
+		}
+		p.state = partialValue
+	case partialCommaOrClose:
+		top := p.stack[len(p.stack)-1]
+		switch {
+		case c == ',' && top.isArray:
+			p.state = partialValue
+		case c == ',':
+			p.state = partialKey
+		case c == ']' && top.isArray, c == '}' && !top.isArray:
+			return p.closeContainer()
+		case top.isArray:
+			return fmt.Errorf("expected ',' or ']' at offset %d", p.parsed)
+		default:
+			return fmt.Errorf("expected ',' or '}' at offset %d", p.parsed)
+		}
+	case partialDone:
+		return fmt.Errorf("unexpected %q after JSON value at offset %d", c, p.parsed)
+	}
+
+	return nil
+}
+
+// startValue starts the value beginning with c.
+func (p *PartialJSONParser) startValue(c byte) error {
+	path := p.valuePath()
+
+	switch {
+	case c == '{':
+		p.stack = append(p.stack, &partialContainer{path: path, object: map[string]any{}})
+		p.state = partialKeyOrClose
+	case c == '[':
+		p.stack = append(p.stack, &partialContainer{path: path, isArray: true, array: []any{}})
+		p.state = partialValueOrClose
+	case c == '"':
+		p.scalar = partialScalar{kind: scalarString, path: path}
+	case c == '-' || (c >= '0' && c <= '9'):
+		p.scalar = partialScalar{kind: scalarNumber, path: path, start: p.parsed}
+		p.scalar.buf.WriteByte(c)
+	case c == 't':
+		p.scalar = partialScalar{kind: scalarLiteral, path: path, start: p.parsed, literal: "true", value: true}
+	case c == 'f':
+		p.scalar = partialScalar{kind: scalarLiteral, path: path, start: p.parsed, literal: "false", value: false}
+	case c == 'n':
+		p.scalar = partialScalar{kind: scalarLiteral, path: path, start: p.parsed, literal: "null"}
+	default:
+		return fmt.Errorf("invalid character %q at offset %d", c, p.parsed)
+	}
+
+	return nil
+}
+
+// valuePath returns the path of the value starting in the innermost open container.
+func (p *PartialJSONParser) valuePath() string {
+	if len(p.stack) == 0 {
+		return ""
+	}
+	top := p.stack[len(p.stack)-1]
+	if top.isArray {
+		return fmt.Sprintf("%s[%d]", top.path, len(top.array))
+	}
+	return joinPath(top.path, top.key)
+}
+
+// endValue adds a complete value to the innermost open container, or ends the document.
+func (p *PartialJSONParser) endValue(value any) {
+	p.scalar = partialScalar{}
+
+	if len(p.stack) == 0 {
+		p.root = value
+		p.state = partialDone
+		return
+	}
+
+	top := p.stack[len(p.stack)-1]
+	if top.isArray {
+		top.array = append(top.array, value)
+	} else {
+		top.object[top.key] = value
+	}
+	p.state = partialCommaOrClose
+}
+
+// closeContainer ends the innermost open container.
+func (p *PartialJSONParser) closeContainer() error {
+	top := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	if top.isArray {
+		p.endValue(top.array)
+	} else {
+		p.endValue(top.object)
+	}
+	return nil
+}
+
+// stepString reads a byte of a string.
+func (p *PartialJSONParser) stepString(c byte) error {
+	s := &p.scalar
+	if len(s.escape) > 0 {
+		s.escape = append(s.escape, c)
+		return p.stepEscape()
+	}
+
+	switch {
+	case c == '\\':
+		s.escape = append(s.escape, c)
+	case c == '"':
+		s.flushSurrogate()
+		if !s.key {
+			p.endValue(s.buf.String())
+			return nil
+		}
+		p.stack[len(p.stack)-1].key = s.buf.String()
+		p.scalar = partialScalar{}
+		p.state = partialColon
+	case c < 0x20:
+		return fmt.Errorf("invalid control character in string at offset %d", p.parsed)
+	default:
+		s.flushSurrogate()
+		s.buf.WriteByte(c)
+	}
+
+	return nil
+}
+
+// stepEscape reads a byte of an escape sequence, combining surrogate pairs.
+func (p *PartialJSONParser) stepEscape() error {
+	s := &p.scalar
+	start := p.parsed - len(s.escape) + 1
+
+	if len(s.escape) == 2 {
+		var b byte
+		switch escape := s.escape[1]; escape {
+		case '"', '\\', '/':
+			b = escape
+		case 'b':
+			b = '\b'
+		case 'f':
+			b = '\f'
+		case 'n':
+			b = '\n'
+		case 'r':
+			b = '\r'
+		case 't':
+			b = '\t'
+		case 'u':
+			return nil
+		default:
+			return fmt.Errorf("invalid escape %q at offset %d", escape, start)
+		}
+		s.flushSurrogate()
+		s.buf.WriteByte(b)
+		s.escape = s.escape[:0]
+		return nil
+	}
+
+	if len(s.escape) < 6 {
+		return nil
+	}
+	v, err := strconv.ParseUint(string(s.escape[2:]), 16, 16)
+	if err != nil {
+		return fmt.Errorf("invalid unicode escape at offset %d", start)
+	}
+	s.escape = s.escape[:0]
+
+	r := rune(v)
+	switch {
+	case s.high != 0:
+		s.buf.WriteRune(utf16.DecodeRune(s.high, r))
+		s.high = 0
+	case utf16.IsSurrogate(r):
+		s.high = r
+	default:
+		s.buf.WriteRune(r)
+	}
+
+	return nil
+}
+
+// flushSurrogate writes a high surrogate that was not followed by its low half.
+func (s *partialScalar) flushSurrogate() {
+	if s.high != 0 {
+		s.buf.WriteRune(utf8.RuneError)
+		s.high = 0
+	}
+}
+
+// stepLiteral reads a byte of true, false or null.
+func (p *PartialJSONParser) stepLiteral(c byte) error {
+	s := &p.scalar
+	if c != s.literal[s.buf.Len()+1] {
+		return fmt.Errorf("invalid literal at offset %d", s.start)
+	}
+	s.buf.WriteByte(c)
+
+	if s.buf.Len()+1 == len(s.literal) {
+		p.endValue(s.value)
+	}
+	return nil
+}
+
+// endNumber ends the number being read.
+func (p *PartialJSONParser) endNumber() error {
+	text := p.scalar.buf.String()
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q at offset %d", text, p.scalar.start)
+	}
+	p.endValue(number)
+	return nil
+}
+
+// result returns the value parsed so far. At the end of the document, a number ending it is
+// complete.
+func (p *PartialJSONParser) result(end bool) (PartialJSON, error) {
+	if p.state == partialDone {
+		return PartialJSON{Value: p.root, Complete: true}, nil
+	}
+
+	var incomplete []string
+	for _, container := range p.stack {
+		if container.path != "" {
+			incomplete = append(incomplete, container.path)
+		}
+	}
+
+	// the value being read, when some of it can be recovered
+	var value any
+	ok := false
+
+	s := &p.scalar
+	switch s.kind {
+	case scalarString:
+		if !s.key {
+			value, ok = trimPartialRune(s.buf.String()), true
+		}
+	case scalarNumber:
+		text := s.buf.String()
+		trimmed := strings.TrimRight(text, "+-.eE")
+		if end && len(p.stack) == 0 && trimmed == text {
+			if err := p.endNumber(); err != nil {
+				return PartialJSON{}, err
+			}
+			return PartialJSON{Value: p.root, Complete: true}, nil
+		}
+		if trimmed != "" {
+			number, err := strconv.ParseFloat(trimmed, 64)
+			if err != nil {
+				return PartialJSON{}, fmt.Errorf("invalid number %q at offset %d", trimmed, s.start)
+			}
+			value, ok = number, true
+		}
+	case scalarLiteral:
+		value, ok = s.value, true
+	}
+	if ok && s.path != "" {
+		incomplete = append(incomplete, s.path)
+	}
+
+	// copy the open containers, as the parser keeps adding to them
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		container := p.stack[i]
+		if container.isArray {
+			array := make([]any, len(container.array), len(container.array)+1)
+			copy(array, container.array)
+			if ok {
+				array = append(array, value)
+			}
+			value = array
+		} else {
+			object := maps.Clone(container.object)
+			if ok {
+				object[container.key] = value
+			}
+			value = object
+		}
+		ok = true
+	}
+
+	return PartialJSON{Value: value, Incomplete: incomplete}, nil
+}
+
+// trimPartialRune removes a multi-byte character split across fragments from the end of s.
+func trimPartialRune(s string) string {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				return s[:i]
+			}
+			break
+		}
+	}
+	return s
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,252 @@
+package anthrogo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartialJSON(t *testing.T) {
+	testCases := []struct {
+		name               string
+		input              string
+		expectedValue      any
+		expectedComplete   bool
+		expectedIncomplete []string
+	}{
+		{
+			name:  "empty",
+			input: "  ",
+		},
+		{
+			name:          "open object",
+			input:         `{`,
+			expectedValue: map[string]any{},
+		},
+		{
+			name:          "key without value",
+			input:         `{"city": "Paris", "da`,
+			expectedValue: map[string]any{"city": "Paris"},
+		},
+		{
+			name:          "key before colon",
+			input:         `{"city": "Paris", "days"`,
+			expectedValue: map[string]any{"city": "Paris"},
+		},
+		{
+			name:               "open string",
+			input:              `{"city": "Par`,
+			expectedValue:      map[string]any{"city": "Par"},
+			expectedIncomplete: []string{"city"},
+		},
+		{
+			name:               "truncated escape",
+			input:              `{"text": "a\`,
+			expectedValue:      map[string]any{"text": "a"},
+			expectedIncomplete: []string{"text"},
+		},
+		{
+			name:               "truncated unicode escape",
+			input:              `{"text": "caf\u00`,
+			expectedValue:      map[string]any{"text": "caf"},
+			expectedIncomplete: []string{"text"},
+		},
+		{
+			name:             "surrogate pair",
+			input:            `{"text": "\ud83d\ude00"}`,
+			expectedValue:    map[string]any{"text": "😀"},
+			expectedComplete: true,
+		},
+		{
+			name:               "truncated number",
+			input:              `{"days": 1.`,
+			expectedValue:      map[string]any{"days": float64(1)},
+			expectedIncomplete: []string{"days"},
+		},
+		{
+			name:          "sign only",
+			input:         `{"days": -`,
+			expectedValue: map[string]any{},
+		},
+		{
+			name:               "truncated literal",
+			input:              `{"ok": tr`,
+			expectedValue:      map[string]any{"ok": true},
+			expectedIncomplete: []string{"ok"},
+		},
+		{
+			name:               "nested",
+			input:              `{"rows": [{"name": "a", "tags": ["x"]}, {"name": "b`,
+			expectedValue:      map[string]any{"rows": []any{map[string]any{"name": "a", "tags": []any{"x"}}, map[string]any{"name": "b"}}},
+			expectedIncomplete: []string{"rows", "rows[1]", "rows[1].name"},
+		},
+		{
+			name:               "trailing comma",
+			input:              `[1, 2, `,
+			expectedValue:      []any{float64(1), float64(2)},
+			expectedIncomplete: nil,
+		},
+		{
+			name:             "top-level number",
+			input:            `42`,
+			expectedValue:    float64(42),
+			expectedComplete: true,
+		},
+		{
+			name:          "truncated top-level number",
+			input:         `4.`,
+			expectedValue: float64(4),
+		},
+		{
+			name:               "split character",
+			input:              "{\"text\": \"caf\xc3",
+			expectedValue:      map[string]any{"text": "caf"},
+			expectedIncomplete: []string{"text"},
+		},
+		{
+			name:             "complete",
+			input:            `{"a": [1, null, false], "b": {}}`,
+			expectedValue:    map[string]any{"a": []any{float64(1), nil, false}, "b": map[string]any{}},
+			expectedComplete: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			partial, err := ParsePartialJSON(tc.input)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedValue, partial.Value)
+			assert.Equal(t, tc.expectedComplete, partial.Complete)
+			assert.Equal(t, tc.expectedIncomplete, partial.Incomplete)
+		})
+	}
+}
+
+func TestParsePartialJSON_Errors(t *testing.T) {
+	for _, input := range []string{`{"a" 1`, `{1`, `[1 2`, `{"a": tx}`, `{"a": "\q"}`, `{} x`, `?`} {
+		_, err := ParsePartialJSON(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestPartialJSONParser_Feed(t *testing.T) {
+	type row struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	type table struct {
+		Title string `json:"title"`
+		Rows  []row  `json:"rows"`
+	}
+
+	document := `{"title": "Scores", "rows": [{"name": "ann", "score": 3}, {"name": "bob", "score": 12}]}`
+	parser := NewPartialJSONParser()
+
+	var last PartialJSON
+	for i := 0; i < len(document); i += 7 {
+		end := i + 7
+		if end > len(document) {
+			end = len(document)
+		}
+
+		partial, err := parser.Feed(document[i:end])
+		require.NoError(t, err)
+
+		var tbl table
+		require.NoError(t, partial.Decode(&tbl))
+		assert.True(t, strings.HasPrefix("Scores", tbl.Title))
+		last = partial
+	}
+
+	assert.True(t, last.Complete)
+	assert.Equal(t, document, parser.String())
+
+	var tbl table
+	require.NoError(t, last.Decode(&tbl))
+	assert.Equal(t, table{Title: "Scores", Rows: []row{{"ann", 3}, {"bob", 12}}}, tbl)
+
+	partial, err := ParsePartialJSON(`{"title": "Sco`)
+	require.NoError(t, err)
+	assert.True(t, partial.IsIncomplete("title"))
+	assert.True(t, partial.IsIncomplete(""))
+	assert.False(t, partial.IsIncomplete("rows"))
+	assert.Equal(t, map[string]any{"title": "Sco"}, partial.Map())
+}
+
+func TestPartialJSONParser_Incremental(t *testing.T) {
+	documents := []string{
+		`{"title": "caf\u00e9 \ud83d\ude00", "rows": [{"n": -1.5e3, "ok": true}, null, [false]], "s": "a\"b"}`,
+		`["日本", {"a": {}}, [], 12]`,
+	}
+
+	for _, document := range documents {
+		// feeding byte by byte gives the same results as parsing each prefix at once
+		parser := NewPartialJSONParser()
+		var results []PartialJSON
+		for i := 0; i < len(document); i++ {
+			partial, err := parser.Feed(document[i : i+1])
+			require.NoError(t, err)
+
+			expected, err := ParsePartialJSON(document[:i+1])
+			require.NoError(t, err)
+			assert.Equal(t, expected, partial, document[:i+1])
+			results = append(results, partial)
+		}
+		assert.True(t, results[len(results)-1].Complete)
+
+		// earlier results are not changed by later fragments
+		for i, partial := range results {
+			expected, err := ParsePartialJSON(document[:i+1])
+			require.NoError(t, err)
+			assert.Equal(t, expected, partial)
+		}
+	}
+
+	// a number may still grow until something follows it
+	parser := NewPartialJSONParser()
+	partial, err := parser.Feed(`4`)
+	require.NoError(t, err)
+	assert.False(t, partial.Complete)
+	partial, err = parser.Feed(`2 `)
+	require.NoError(t, err)
+	assert.True(t, partial.Complete)
+	assert.Equal(t, float64(42), partial.Value)
+
+	// errors are kept
+	_, err = parser.Feed(`x`)
+	assert.EqualError(t, err, `unexpected 'x' after JSON value at offset 3`)
+	_, err = parser.Feed(` `)
+	assert.Error(t, err)
+}
+
+func TestMessageSSEDecoder_PartialInput(t *testing.T) {
+	input := `event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "table", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "{\"rows\": [\"a\", \"b"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "c\"]}"}}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+	options := DecodeOptions{PartialInput: true}
+
+	_, err := decoder.Decode(options)
+	require.NoError(t, err)
+
+	event, err := decoder.Decode(options)
+	require.NoError(t, err)
+	require.NotNil(t, event.Data.PartialInput)
+	assert.Equal(t, map[string]any{"rows": []any{"a", "b"}}, event.Data.PartialInput.Map())
+	assert.Equal(t, []string{"rows", "rows[1]"}, event.Data.PartialInput.Incomplete)
+
+	event, err = decoder.Decode(options)
+	require.NoError(t, err)
+	assert.True(t, event.Data.PartialInput.Complete)
+	assert.Equal(t, map[string]any{"rows": []any{"a", "bc"}}, event.Data.PartialInput.Map())
+}
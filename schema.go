@@ -0,0 +1,593 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON schema used to describe tool inputs.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	byteSliceType     = reflect.TypeOf([]byte(nil))
+)
+
+// SchemaFor generates the JSON schema of T by reflection. Field names follow the json tag
+// and a jsonschema tag adds constraints, for example:
+//
+//	type Input struct {
+//		City  string  `json:"city" jsonschema:"description=City name,pattern=^[A-Z]"`
+//		Unit  string  `json:"unit,omitempty" jsonschema:"enum=celsius|fahrenheit"`
+//		Days  int     `json:"days" jsonschema:"minimum=1,maximum=14"`
+//		Limit *int    `json:"limit" jsonschema:"required"`
+//	}
+//
+// Fields are required unless they are pointers or tagged omitempty; the required option
+// overrides this. minimum and maximum constrain the length of strings and slices, and enum
+// constrains the elements of slices. Commas inside a value are escaped as \,.
+func SchemaFor[T any]() (*Schema, error) {
+	return schemaForType(reflect.TypeOf((*T)(nil)).Elem(), map[reflect.Type]bool{})
+}
+
+// schemaForType generates the schema of t. seen holds the struct types currently being
+// expanded so that recursive types are reported instead of looping forever.
+func schemaForType(t reflect.Type, seen map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case rawMessageType:
+		return &Schema{}, nil
+	case byteSliceType:
+		return &Schema{Type: "string", Format: "byte"}, nil
+	}
+
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return &Schema{}, nil
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		minimum := 0.0
+		return &Schema{Type: "integer", Minimum: &minimum}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaForType(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if !isMapKeyKind(t.Key().Kind()) && !t.Key().Implements(textMarshalerType) {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := schemaForType(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		schema := &Schema{Type: "object"}
+		if values.Type != "" {
+			schema.AdditionalProperties = values
+		}
+		return schema, nil
+	case reflect.Struct:
+		if seen[t] {
+			return nil, fmt.Errorf("recursive type %s is not supported", t)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		if err := addStructFields(schema, t, seen); err != nil {
+			return nil, err
+		}
+		sort.Strings(schema.Required)
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// structField is a field of a struct or of the structs it embeds, before the fields sharing
+// its name are resolved.
+type structField struct {
+	field    reflect.StructField
+	name     string
+	jsonOpts string
+	// depth is the number of embedded structs the field is promoted through.
+	depth  int
+	tagged bool
+}
+
+// addStructFields adds the properties of struct type t to schema, flattening embedded
+// structs the way encoding/json does: of the fields sharing a name, the least nested one
+// wins, then the one named by a json tag, and the name is left out when that is ambiguous.
+func addStructFields(schema *Schema, t reflect.Type, seen map[reflect.Type]bool) error {
+	fields, err := collectStructFields(t, 0, seen)
+	if err != nil {
+		return err
+	}
+
+	byName := map[string][]structField{}
+	for _, field := range fields {
+		byName[field.name] = append(byName[field.name], field)
+	}
+
+	for _, field := range fields {
+		if dominant, ok := dominantField(byName[field.name]); !ok || !slices.Equal(dominant.field.Index, field.field.Index) {
+			continue
+		}
+
+		property, err := schemaForType(field.field.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.field.Name, err)
+		}
+
+		required := field.field.Type.Kind() != reflect.Pointer && !hasTagOption(field.jsonOpts, "omitempty")
+		if tag, ok := field.field.Tag.Lookup("jsonschema"); ok {
+			explicit, err := applySchemaTag(property, tag)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.field.Name, err)
+			}
+			required = required || explicit
+		}
+
+		schema.Properties[field.name] = property
+		if required {
+			schema.Required = append(schema.Required, field.name)
+		}
+	}
+
+	return nil
+}
+
+// collectStructFields lists the fields encoding/json would consider for struct type t, in
+// declaration order, including the fields promoted from embedded structs.
+func collectStructFields(t reflect.Type, depth int, seen map[reflect.Type]bool) ([]structField, error) {
+	var fields []structField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, jsonOpts, _ := strings.Cut(jsonTag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous {
+			if !field.IsExported() && (field.Type.Kind() == reflect.Pointer || fieldType.Kind() != reflect.Struct) {
+				continue
+			}
+			if name == "" && fieldType.Kind() == reflect.Struct {
+				if seen[fieldType] {
+					return nil, fmt.Errorf("recursive type %s is not supported", fieldType)
+				}
+				seen[fieldType] = true
+				embedded, err := collectStructFields(fieldType, depth+1, seen)
+				delete(seen, fieldType)
+				if err != nil {
+					return nil, err
+				}
+				for _, promoted := range embedded {
+					promoted.field.Index = append([]int{i}, promoted.field.Index...)
+					fields = append(fields, promoted)
+				}
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		tagged := name != ""
+		if !tagged {
+			name = field.Name
+		}
+		fields = append(fields, structField{field: field, name: name, jsonOpts: jsonOpts, depth: depth, tagged: tagged})
+	}
+
+	return fields, nil
+}
+
+// dominantField returns the field encoding/json uses among fields sharing a name, if any.
+func dominantField(fields []structField) (structField, bool) {
+	depth := fields[0].depth
+	for _, field := range fields[1:] {
+		depth = min(depth, field.depth)
+	}
+
+	var shallowest, tagged []structField
+	for _, field := range fields {
+		if field.depth != depth {
+			continue
+		}
+		shallowest = append(shallowest, field)
+		if field.tagged {
+			tagged = append(tagged, field)
+		}
+	}
+
+	switch {
+	case len(shallowest) == 1:
+		return shallowest[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	default:
+		return structField{}, false
+	}
+}
+
+// isMapKeyKind reports whether encoding/json encodes map keys of kind k without a
+// TextMarshaler.
+func isMapKeyKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// applySchemaTag applies the options of a jsonschema struct tag to schema and reports
+// whether the field was explicitly marked as required.
+func applySchemaTag(schema *Schema, tag string) (bool, error) {
+	required := false
+
+	for _, option := range splitSchemaTag(tag) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key = strings.TrimSpace(key); key {
+		case "":
+		case "required":
+			required = true
+		case "description":
+			schema.Description = value
+		case "format":
+			schema.Format = value
+		case "pattern":
+			if _, err := regexp.Compile(value); err != nil {
+				return false, fmt.Errorf("invalid pattern %q: %w", value, err)
+			}
+			schema.Pattern = value
+		case "enum":
+			// the values of an array are those of its items
+			target := schema
+			if schema.Type == "array" {
+				target = schema.Items
+			}
+			for _, raw := range strings.Split(value, "|") {
+				enumValue, err := parseSchemaValue(target.Type, raw)
+				if err != nil {
+					return false, fmt.Errorf("invalid enum value %q: %w", raw, err)
+				}
+				target.Enum = append(target.Enum, enumValue)
+			}
+		case "minimum", "maximum":
+			if err := applySchemaBound(schema, key == "minimum", value); err != nil {
+				return false, err
+			}
+		default:
+			return false, fmt.Errorf("unknown jsonschema option %q", key)
+		}
+	}
+
+	return required, nil
+}
+
+// applySchemaBound sets the lower or upper bound of a number, or the length bound of a
+// string or array.
+func applySchemaBound(schema *Schema, lower bool, value string) error {
+	switch schema.Type {
+	case "integer", "number":
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bound %q: %w", value, err)
+		}
+		if lower {
+			schema.Minimum = &bound
+		} else {
+			schema.Maximum = &bound
+		}
+	case "string", "array":
+		bound, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid length bound %q: %w", value, err)
+		}
+		switch {
+		case schema.Type == "string" && lower:
+			schema.MinLength = &bound
+		case schema.Type == "string":
+			schema.MaxLength = &bound
+		case lower:
+			schema.MinItems = &bound
+		default:
+			schema.MaxItems = &bound
+		}
+	default:
+		return fmt.Errorf("bounds are not supported on type %q", schema.Type)
+	}
+
+	return nil
+}
+
+// parseSchemaValue converts an enum value from a struct tag to the schema type.
+func parseSchemaValue(schemaType string, raw string) (any, error) {
+	switch schemaType {
+	case "integer", "number":
+		return strconv.ParseFloat(raw, 64)
+	case "boolean":
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// splitSchemaTag splits a jsonschema tag on unescaped commas.
+func splitSchemaTag(tag string) []string {
+	var (
+		options []string
+		current strings.Builder
+	)
+
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			options = append(options, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+
+	return append(options, current.String())
+}
+
+func hasTagOption(options string, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a value decoded by encoding/json into an any against the schema.
+func (s *Schema) Validate(value any) error {
+	return s.validate("input", value)
+}
+
+func (s *Schema) validate(path string, value any) error {
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		return fmt.Errorf("%s: value %v is not one of %v", path, value, s.Enum)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %s", path, jsonTypeName(value))
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %s", path, s.Type, jsonTypeName(value))
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			return fmt.Errorf("%s: expected integer, got %v", path, number)
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than the minimum %v", path, number, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Errorf("%s: %v is greater than the maximum %v", path, number, *s.Maximum)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %s", path, jsonTypeName(value))
+		}
+		length := len([]rune(str))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: length %d is less than the minimum %d", path, length, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: length %d is greater than the maximum %d", path, length, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			matched, err := regexp.MatchString(s.Pattern, str)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern %q: %w", path, s.Pattern, err)
+			}
+			if !matched {
+				return fmt.Errorf("%s: %q does not match pattern %q", path, str, s.Pattern)
+			}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: %q is not an RFC 3339 date-time", path, str)
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", path, jsonTypeName(value))
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			return fmt.Errorf("%s: %d items is less than the minimum %d", path, len(items), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return fmt.Errorf("%s: %d items is greater than the maximum %d", path, len(items), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", path, jsonTypeName(value))
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, property := range object {
+			schema, ok := s.Properties[name]
+			if !ok {
+				schema = s.AdditionalProperties
+			}
+			if schema == nil || (property == nil && !slices.Contains(s.Required, name)) {
+				continue
+			}
+			if err := schema.validate(path+"."+name, property); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+
+	return nil
+}
+
+func enumContains(enum []any, value any) bool {
+	for _, candidate := range enum {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// NewTool creates a ToolHandler whose input schema is generated from In. Before fn is
+// called the tool_use input is validated against the schema and decoded into In. A string
+// or []MessageContent output is sent back as is, any other output is sent as JSON text.
+func NewTool[In, Out any](name, description string, fn func(ctx context.Context, input In) (Out, error)) (ToolHandler, error) {
+	schema, err := SchemaFor[In]()
+	if err != nil {
+		return ToolHandler{}, fmt.Errorf("tool %q: %w", name, err)
+	}
+	if schema.Type != "object" {
+		return ToolHandler{}, fmt.Errorf("tool %q: input must be a struct or map, got %q", name, schema.Type)
+	}
+
+	return ToolHandler{
+		Tool: Tool{Name: name, Description: description, InputSchema: schema},
+		Func: func(ctx context.Context, raw json.RawMessage) ([]MessageContent, error) {
+			var decoded any
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				return nil, fmt.Errorf("invalid tool input: %w", err)
+			}
+			if err := schema.Validate(decoded); err != nil {
+				return nil, fmt.Errorf("invalid tool input: %w", err)
+			}
+
+			var input In
+			if err := json.Unmarshal(raw, &input); err != nil {
+				return nil, fmt.Errorf("invalid tool input: %w", err)
+			}
+
+			output, err := fn(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+
+			return toolOutputContent(output)
+		},
+	}, nil
+}
+
+// toolOutputContent converts the output of a typed tool into tool_result content.
+func toolOutputContent(output any) ([]MessageContent, error) {
+	switch out := output.(type) {
+	case string:
+		return []MessageContent{NewTextContent(out)}, nil
+	case []MessageContent:
+		return out, nil
+	default:
+		data, err := json.Marshal(out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tool output: %w", err)
+		}
+		return []MessageContent{NewTextContent(string(data))}, nil
+	}
+}
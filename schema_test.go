@@ -0,0 +1,333 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaAddress struct {
+	Street string `json:"street"`
+	Zip    string `json:"zip,omitempty" jsonschema:"pattern=^[0-9]{5}$"`
+}
+
+type schemaBase struct {
+	ID string `json:"id" jsonschema:"description=Unique id\\, opaque"`
+}
+
+type schemaInput struct {
+	schemaBase
+	City     string           `json:"city" jsonschema:"description=City name,minimum=2"`
+	Unit     string           `json:"unit,omitempty" jsonschema:"enum=celsius|fahrenheit"`
+	Days     int              `json:"days" jsonschema:"minimum=1,maximum=14"`
+	Limit    *int             `json:"limit" jsonschema:"required"`
+	Note     *string          `json:"note"`
+	Tags     []string         `json:"tags,omitempty" jsonschema:"maximum=3"`
+	Labels   map[string]int   `json:"labels,omitempty"`
+	Extra    map[string]any   `json:"extra,omitempty"`
+	Since    time.Time        `json:"since"`
+	Address  schemaAddress    `json:"address"`
+	Previous []*schemaAddress `json:"previous,omitempty"`
+	Ignored  string           `json:"-"`
+	hidden   string
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Scores   map[string]string `json:"scores,omitempty"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := SchemaFor[schemaInput]()
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string", "description": "Unique id, opaque"},
+			"city": {"type": "string", "description": "City name", "minLength": 2},
+			"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]},
+			"days": {"type": "integer", "minimum": 1, "maximum": 14},
+			"limit": {"type": "integer"},
+			"note": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 3},
+			"labels": {"type": "object", "additionalProperties": {"type": "integer"}},
+			"extra": {"type": "object"},
+			"since": {"type": "string", "format": "date-time"},
+			"address": {
+				"type": "object",
+				"properties": {
+					"street": {"type": "string"},
+					"zip": {"type": "string", "pattern": "^[0-9]{5}$"}
+				},
+				"required": ["street"]
+			},
+			"previous": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"street": {"type": "string"},
+						"zip": {"type": "string", "pattern": "^[0-9]{5}$"}
+					},
+					"required": ["street"]
+				}
+			},
+			"raw": {},
+			"scores": {"type": "object", "additionalProperties": {"type": "string"}}
+		},
+		"required": ["address", "city", "days", "id", "limit", "since"]
+	}`, string(data))
+}
+
+type schemaNamed struct {
+	Name  string `json:"name"`
+	Shade string
+	Color string
+}
+
+type schemaTagged struct {
+	Title string `json:"Shade,omitempty"`
+	Color string
+}
+
+type schemaShadowing struct {
+	schemaNamed
+	schemaTagged
+	Name string `json:"name,omitempty"`
+}
+
+func TestSchemaFor_Embedded(t *testing.T) {
+	schema, err := SchemaFor[schemaShadowing]()
+	require.NoError(t, err)
+
+	// name is shadowed by the outer field, Shade by the tagged field and Color is ambiguous
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"Shade": {"type": "string"}
+		}
+	}`, string(data))
+
+	// the properties are the fields encoding/json writes
+	data, err = json.Marshal(schemaShadowing{Name: "a", schemaTagged: schemaTagged{Title: "b"}})
+	require.NoError(t, err)
+	var encoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &encoded))
+	assert.Equal(t, map[string]any{"name": "a", "Shade": "b"}, encoded)
+}
+
+func TestSchemaFor_SliceEnumAndIntKeys(t *testing.T) {
+	schema, err := SchemaFor[struct {
+		Units  []string       `json:"units" jsonschema:"enum=celsius|fahrenheit,maximum=2"`
+		Counts map[int]string `json:"counts"`
+	}]()
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"units": {"type": "array", "items": {"type": "string", "enum": ["celsius", "fahrenheit"]}, "maxItems": 2},
+			"counts": {"type": "object", "additionalProperties": {"type": "string"}}
+		},
+		"required": ["counts", "units"]
+	}`, string(data))
+
+	assert.NoError(t, schema.Validate(map[string]any{"units": []any{"celsius"}, "counts": map[string]any{"1": "a"}}))
+	assert.EqualError(t, schema.Validate(map[string]any{"units": []any{"kelvin"}, "counts": map[string]any{}}),
+		"input.units[0]: value kelvin is not one of [celsius fahrenheit]")
+}
+
+func TestSchemaFor_Unsigned(t *testing.T) {
+	schema, err := SchemaFor[struct {
+		Count uint   `json:"count"`
+		Page  uint32 `json:"page" jsonschema:"minimum=1"`
+		Delta int    `json:"delta"`
+	}]()
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"count": {"type": "integer", "minimum": 0},
+			"page": {"type": "integer", "minimum": 1},
+			"delta": {"type": "integer"}
+		},
+		"required": ["count", "delta", "page"]
+	}`, string(data))
+
+	assert.NoError(t, schema.Validate(map[string]any{"count": 0.0, "page": 1.0, "delta": -1.0}))
+	assert.EqualError(t, schema.Validate(map[string]any{"count": -1.0, "page": 1.0, "delta": 0.0}),
+		"input.count: -1 is less than the minimum 0")
+}
+
+type schemaRecursive struct {
+	Children []schemaRecursive `json:"children"`
+}
+
+func TestSchemaFor_Errors(t *testing.T) {
+	_, err := SchemaFor[schemaRecursive]()
+	assert.EqualError(t, err, "field Children: recursive type anthrogo.schemaRecursive is not supported")
+
+	_, err = SchemaFor[struct {
+		C chan int `json:"c"`
+	}]()
+	assert.EqualError(t, err, "field C: unsupported type chan int")
+
+	_, err = SchemaFor[struct {
+		M map[bool]string `json:"m"`
+	}]()
+	assert.EqualError(t, err, "field M: unsupported map key type bool")
+
+	_, err = SchemaFor[struct {
+		S string `json:"s" jsonschema:"color=red"`
+	}]()
+	assert.EqualError(t, err, `field S: unknown jsonschema option "color"`)
+
+	_, err = SchemaFor[struct {
+		B bool `json:"b" jsonschema:"minimum=1"`
+	}]()
+	assert.EqualError(t, err, `field B: bounds are not supported on type "boolean"`)
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := SchemaFor[schemaInput]()
+	require.NoError(t, err)
+
+	valid := `{"id": "1", "city": "Paris", "days": 3, "limit": 1, "note": null,
+		"since": "2024-01-02T03:04:05Z", "address": {"street": "Rue", "zip": "75001"}}`
+
+	testCases := []struct {
+		name          string
+		input         string
+		expectedError string
+	}{
+		{name: "valid", input: valid},
+		{
+			name:          "missing required",
+			input:         `{"id": "1"}`,
+			expectedError: `input: missing required property "address"`,
+		},
+		{
+			name:          "wrong type",
+			input:         `{"id": 1, "city": "Paris", "days": 3, "limit": 1, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.id: expected string, got number",
+		},
+		{
+			name:          "not an integer",
+			input:         `{"id": "1", "city": "Paris", "days": 1.5, "limit": 1, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.days: expected integer, got 1.5",
+		},
+		{
+			name:          "above maximum",
+			input:         `{"id": "1", "city": "Paris", "days": 15, "limit": 1, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.days: 15 is greater than the maximum 14",
+		},
+		{
+			name:          "enum",
+			input:         `{"id": "1", "city": "Paris", "unit": "kelvin", "days": 1, "limit": 1, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.unit: value kelvin is not one of [celsius fahrenheit]",
+		},
+		{
+			name:          "nested pattern",
+			input:         `{"id": "1", "city": "Paris", "days": 1, "limit": 1, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue", "zip": "abc"}}`,
+			expectedError: `input.address.zip: "abc" does not match pattern "^[0-9]{5}$"`,
+		},
+		{
+			name:          "too many items",
+			input:         `{"id": "1", "city": "Paris", "days": 1, "limit": 1, "tags": ["a", "b", "c", "d"], "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.tags: 4 items is greater than the maximum 3",
+		},
+		{
+			name:          "date-time",
+			input:         `{"id": "1", "city": "Paris", "days": 1, "limit": 1, "since": "yesterday", "address": {"street": "Rue"}}`,
+			expectedError: `input.since: "yesterday" is not an RFC 3339 date-time`,
+		},
+		{
+			name:          "additional properties",
+			input:         `{"id": "1", "city": "Paris", "days": 1, "limit": 1, "labels": {"a": "b"}, "since": "2024-01-02T03:04:05Z", "address": {"street": "Rue"}}`,
+			expectedError: "input.labels.a: expected integer, got string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tc.input), &value))
+
+			err := schema.Validate(value)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+type weatherInput struct {
+	City string `json:"city"`
+	Days int    `json:"days" jsonschema:"minimum=1"`
+}
+
+type weatherOutput struct {
+	Forecast []string `json:"forecast"`
+}
+
+func TestNewTool(t *testing.T) {
+	handler, err := NewTool("weather", "Get a forecast", func(ctx context.Context, in weatherInput) (weatherOutput, error) {
+		if in.City == "Atlantis" {
+			return weatherOutput{}, errors.New("city not found")
+		}
+		forecast := make([]string, in.Days)
+		for i := range forecast {
+			forecast[i] = "sunny in " + in.City
+		}
+		return weatherOutput{Forecast: forecast}, nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "weather", handler.Tool.Name)
+	assert.Equal(t, "Get a forecast", handler.Tool.Description)
+	require.IsType(t, &Schema{}, handler.Tool.InputSchema)
+	assert.Equal(t, []string{"city", "days"}, handler.Tool.InputSchema.(*Schema).Required)
+
+	content, err := handler.Func(context.Background(), json.RawMessage(`{"city": "Paris", "days": 2}`))
+	require.NoError(t, err)
+	assert.Equal(t, []MessageContent{NewTextContent(`{"forecast":["sunny in Paris","sunny in Paris"]}`)}, content)
+
+	_, err = handler.Func(context.Background(), json.RawMessage(`{"city": "Paris", "days": 0}`))
+	assert.EqualError(t, err, "invalid tool input: input.days: 0 is less than the minimum 1")
+
+	_, err = handler.Func(context.Background(), json.RawMessage(`{"city": "Atlantis", "days": 1}`))
+	assert.EqualError(t, err, "city not found")
+
+	_, err = handler.Func(context.Background(), json.RawMessage(`not json`))
+	assert.ErrorContains(t, err, "invalid tool input")
+}
+
+func TestNewTool_StringOutput(t *testing.T) {
+	handler, err := NewTool("echo", "", func(ctx context.Context, in map[string]string) (string, error) {
+		return in["text"], nil
+	})
+	require.NoError(t, err)
+
+	content, err := handler.Func(context.Background(), json.RawMessage(`{"text": "hi"}`))
+	require.NoError(t, err)
+	assert.Equal(t, []MessageContent{NewTextContent("hi")}, content)
+
+	_, err = NewTool("bad", "", func(ctx context.Context, in string) (string, error) { return in, nil })
+	assert.EqualError(t, err, `tool "bad": input must be a struct or map, got "string"`)
+}
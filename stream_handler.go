@@ -0,0 +1,132 @@
+package anthrogo
+
+import (
+	"context"
+)
+
+// StreamHandler holds callbacks for the parts of a message stream, for when a decode loop is
+// more than needed. Callbacks left nil are skipped. A callback returning an error aborts the
+// stream: the request is released and the error is returned by the call handling the stream.
+//
+//	message, err := client.StreamMessage(ctx, payload, StreamHandler{
+//		OnText: func(text string) error {
+//			fmt.Print(text)
+//			return nil
+//		},
+//	})
+type StreamHandler struct {
+	// OnText is called with each piece of text.
+	OnText func(text string) error
+	// OnThinking is called with each piece of thinking of a thinking block.
+	OnThinking func(thinking string) error
+	// OnToolUse is called once a tool_use block is complete, with its parsed input.
+	OnToolUse func(block ContentBlock, input map[string]any) error
+	// OnCitation is called with each citation added to a text block.
+	OnCitation func(citation Citation) error
+	// OnMessage is called with the final message once the stream stops, before the call
+	// handling the stream returns it.
+	OnMessage func(message MessageResponse) error
+	// OnError is called with the error that ends the stream, whether it comes from the
+	// API, the connection or another callback.
+	OnError func(err error)
+}
+
+// StreamMessage sends a message to the model, calls the handler as the response streams in
+// and returns the final message.
+func (c *Client) StreamMessage(ctx context.Context, payload MessagePayload, handler StreamHandler) (MessageResponse, error) {
+	stream, err := c.MessageStreamRequest(ctx, payload)
+	if err != nil {
+		handler.fail(err)
+		return MessageResponse{}, err
+	}
+	return stream.Handle(handler)
+}
+
+// Handle calls the handler for each event of the stream and returns the final message. The
+// stream is closed when it returns. Text and thinking that DecodeOptions.ContentOnly skipped
+// are not seen by the handler; tool_use blocks and citations are only seen without it.
+func (s *MessageStream) Handle(handler StreamHandler) (MessageResponse, error) {
+	defer s.Close()
+
+	for s.Next() {
+		if err := handler.handle(s.Current(), s.decoder.Accumulator()); err != nil {
+			return s.Snapshot(), handler.fail(err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return s.Snapshot(), handler.fail(err)
+	}
+
+	message, err := s.decoder.Accumulator().Final()
+	if err != nil {
+		return message, handler.fail(err)
+	}
+	return message, nil
+}
+
+// Handle calls the handler for each event decoded from the stream, such as a stream saved
+// to disk, and returns the final message.
+func (h StreamHandler) Handle(decoder *MessageSSEDecoder) (MessageResponse, error) {
+	for {
+		event, err := decoder.Decode()
+		if err != nil {
+			return decoder.Accumulator().Snapshot(), h.fail(err)
+		}
+		if event == nil {
+			break
+		}
+		if err := h.handle(event, decoder.Accumulator()); err != nil {
+			return decoder.Accumulator().Snapshot(), h.fail(err)
+		}
+	}
+
+	message, err := decoder.Accumulator().Final()
+	if err != nil {
+		return message, h.fail(err)
+	}
+	return message, nil
+}
+
+// handle calls the callbacks matching an event. The accumulator must have applied the event.
+func (h StreamHandler) handle(event *MessageEventPayload, acc *MessageAccumulator) error {
+	data := event.Data
+
+	if data.Content != "" && h.OnText != nil {
+		if err := h.OnText(data.Content); err != nil {
+			return err
+		}
+	}
+	if data.Thinking != "" && h.OnThinking != nil {
+		if err := h.OnThinking(data.Thinking); err != nil {
+			return err
+		}
+	}
+	if data.Citation != nil && h.OnCitation != nil {
+		if err := h.OnCitation(*data.Citation); err != nil {
+			return err
+		}
+	}
+	if data.ToolUse != nil && h.OnToolUse != nil {
+		if err := h.OnToolUse(*data.ToolUse, data.Input); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := data.Data.(MessageStopData); ok && h.OnMessage != nil {
+		message, err := acc.Final()
+		if err != nil {
+			return err
+		}
+		return h.OnMessage(message)
+	}
+
+	return nil
+}
+
+// fail reports the error ending the stream to OnError and returns it.
+func (h StreamHandler) fail(err error) error {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+	return err
+}
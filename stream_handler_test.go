@@ -0,0 +1,178 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHandler returns a handler appending what it receives to calls.
+func recordingHandler(calls *[]string) StreamHandler {
+	return StreamHandler{
+		OnText: func(text string) error {
+			*calls = append(*calls, "text:"+text)
+			return nil
+		},
+		OnThinking: func(thinking string) error {
+			*calls = append(*calls, "thinking:"+thinking)
+			return nil
+		},
+		OnToolUse: func(block ContentBlock, input map[string]any) error {
+			*calls = append(*calls, fmt.Sprintf("tool_use:%s:%v", block.Name, input))
+			return nil
+		},
+		OnCitation: func(citation Citation) error {
+			*calls = append(*calls, "citation:"+citation.CitedText)
+			return nil
+		},
+		OnMessage: func(message MessageResponse) error {
+			*calls = append(*calls, "message:"+message.StopReason)
+			return nil
+		},
+		OnError: func(err error) {
+			*calls = append(*calls, "error:"+err.Error())
+		},
+	}
+}
+
+func TestStreamHandler_Fixtures(t *testing.T) {
+	for _, tc := range messageSSETestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected []string
+			for _, event := range tc.expectedEvents {
+				if event.Data.Content != "" {
+					expected = append(expected, "text:"+event.Data.Content)
+				}
+			}
+
+			var expectedErr error
+			switch {
+			case tc.expectedError != nil:
+				expectedErr = tc.expectedError
+			case !strings.Contains(tc.input, "message_stop"):
+				expectedErr = ErrIncompleteStream
+			default:
+				expected = append(expected, "message")
+			}
+			if expectedErr != nil {
+				expected = append(expected, "error:"+expectedErr.Error())
+			}
+
+			var calls []string
+			handler := recordingHandler(&calls)
+			handler.OnMessage = func(message MessageResponse) error {
+				calls = append(calls, "message")
+				return nil
+			}
+
+			_, err := handler.Handle(NewMessageSSEDecoder(strings.NewReader(tc.input)))
+			if expectedErr != nil {
+				assert.EqualError(t, err, expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, expected, calls)
+		})
+	}
+}
+
+func TestStreamHandler_ToolUse(t *testing.T) {
+	var calls []string
+	message, err := recordingHandler(&calls).Handle(NewMessageSSEDecoder(strings.NewReader(toolUseStream)))
+	assert.Equal(t, ErrIncompleteStream, err)
+	assert.Equal(t, []string{
+		"tool_use:get_weather:map[city:Paris]",
+		"error:" + ErrIncompleteStream.Error(),
+	}, calls)
+	require.Len(t, message.Content, 2)
+	assert.JSONEq(t, `{"city": "Paris"}`, string(message.Content[1].Input))
+}
+
+func TestStreamHandler_AllCallbacks(t *testing.T) {
+	var calls []string
+	message, err := recordingHandler(&calls).Handle(NewMessageSSEDecoder(strings.NewReader(accumulatorStream)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"thinking:Look it up",
+		"thinking: in the docs.",
+		"citation:Go is fast.",
+		"text:Go is ",
+		"text:fast.",
+		"tool_use:search:map[query:go speed]",
+		"message:tool_use",
+	}, calls)
+
+	var expected MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(accumulatorResponse), &expected))
+	assertSameMessage(t, expected, message)
+}
+
+func TestStreamHandler_Abort(t *testing.T) {
+	abort := errors.New("user went away")
+
+	var calls []string
+	handler := recordingHandler(&calls)
+	handler.OnThinking = func(thinking string) error {
+		return abort
+	}
+
+	message, err := handler.Handle(NewMessageSSEDecoder(strings.NewReader(accumulatorStream)))
+	assert.Equal(t, abort, err)
+	assert.Equal(t, []string{"error:user went away"}, calls)
+	assert.Equal(t, "Look it up", message.Content[0].Thinking)
+}
+
+func TestClient_StreamMessage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, accumulatorStream)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	var calls []string
+	message, err := client.StreamMessage(context.Background(), streamPayload(), recordingHandler(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, "tool_use", message.StopReason)
+	assert.Len(t, calls, 7)
+
+	// request errors are reported too
+	calls = nil
+	_, err = client.StreamMessage(context.Background(), MessagePayload{Model: ModelClaudeInstant1Dot2, MaxTokens: 10, Messages: conversation("hi")}, recordingHandler(&calls))
+	require.EqualError(t, err, "model claude-instant-1.2 does not support the Messages API")
+	assert.Equal(t, []string{"error:" + err.Error()}, calls)
+}
+
+func TestClient_StreamMessageAbortReleasesRequest(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamStart)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(done)
+	}))
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	abort := errors.New("enough")
+	_, err := client.StreamMessage(context.Background(), streamPayload(), StreamHandler{
+		OnText: func(text string) error {
+			return abort
+		},
+	})
+	assert.Equal(t, abort, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not released when the handler aborted")
+	}
+}
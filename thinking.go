@@ -0,0 +1,76 @@
+package anthrogo
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ThinkingTypeEnabled turns extended thinking on.
+	ThinkingTypeEnabled = "enabled"
+	// ThinkingTypeDisabled turns extended thinking off.
+	ThinkingTypeDisabled = "disabled"
+
+	// MinThinkingBudgetTokens is the smallest thinking budget accepted by the API.
+	MinThinkingBudgetTokens = 1024
+)
+
+// ThinkingConfig enables extended thinking. BudgetTokens is the number of tokens the model
+// may spend thinking and counts towards MaxTokens.
+type ThinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// NewThinkingConfig returns a config enabling extended thinking with the given budget.
+func NewThinkingConfig(budgetTokens int) *ThinkingConfig {
+	return &ThinkingConfig{Type: ThinkingTypeEnabled, BudgetTokens: budgetTokens}
+}
+
+// Thinking returns the concatenated text of the thinking blocks of the response.
+func (r MessageResponse) Thinking() string {
+	var thinking string
+	for _, block := range r.Content {
+		if block.Type == string(ContentTypeThinking) {
+			thinking += block.Thinking
+		}
+	}
+	return thinking
+}
+
+// validateThinking checks that the sampling options of the payload are compatible with
+// extended thinking.
+func (p MessagePayload) validateThinking() error {
+	if p.Thinking == nil {
+		return nil
+	}
+
+	switch p.Thinking.Type {
+	case ThinkingTypeDisabled:
+		return nil
+	case ThinkingTypeEnabled:
+	default:
+		return fmt.Errorf("unknown thinking type %q", p.Thinking.Type)
+	}
+
+	if p.Thinking.BudgetTokens < MinThinkingBudgetTokens {
+		return fmt.Errorf("thinking budget_tokens must be at least %d, got %d", MinThinkingBudgetTokens, p.Thinking.BudgetTokens)
+	}
+	if p.Thinking.BudgetTokens >= p.MaxTokens {
+		return fmt.Errorf("thinking budget_tokens (%d) must be less than max_tokens (%d)", p.Thinking.BudgetTokens, p.MaxTokens)
+	}
+	if p.Temperature != nil && *p.Temperature != 1 {
+		return errors.New("temperature may only be set to 1 when thinking is enabled")
+	}
+	if p.TopK != nil {
+		return errors.New("top_k may not be set when thinking is enabled")
+	}
+	if p.TopP != nil && (*p.TopP < 0.95 || *p.TopP > 1) {
+		return errors.New("top_p must be between 0.95 and 1 when thinking is enabled")
+	}
+	if p.ToolChoice != nil && (p.ToolChoice.Type == ToolChoiceAny || p.ToolChoice.Type == ToolChoiceTool) {
+		return fmt.Errorf("tool_choice %q may not be used when thinking is enabled", p.ToolChoice.Type)
+	}
+
+	return nil
+}
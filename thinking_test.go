@@ -0,0 +1,159 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagePayload_ValidateThinking(t *testing.T) {
+	one, warm := 1.0, 0.7
+	topP, lowTopP := 0.95, 0.5
+	topK := 5
+
+	testCases := []struct {
+		name          string
+		payload       MessagePayload
+		expectedError string
+	}{
+		{
+			name:    "valid",
+			payload: MessagePayload{MaxTokens: 4096, Thinking: NewThinkingConfig(2048), Temperature: &one, TopP: &topP},
+		},
+		{
+			name:    "disabled",
+			payload: MessagePayload{MaxTokens: 10, Thinking: &ThinkingConfig{Type: ThinkingTypeDisabled}, TopK: &topK},
+		},
+		{
+			name:          "unknown type",
+			payload:       MessagePayload{MaxTokens: 4096, Thinking: &ThinkingConfig{Type: "maybe"}},
+			expectedError: `unknown thinking type "maybe"`,
+		},
+		{
+			name:          "small budget",
+			payload:       MessagePayload{MaxTokens: 4096, Thinking: NewThinkingConfig(100)},
+			expectedError: "thinking budget_tokens must be at least 1024, got 100",
+		},
+		{
+			name:          "budget over max tokens",
+			payload:       MessagePayload{MaxTokens: 2048, Thinking: NewThinkingConfig(2048)},
+			expectedError: "thinking budget_tokens (2048) must be less than max_tokens (2048)",
+		},
+		{
+			name:          "temperature",
+			payload:       MessagePayload{MaxTokens: 4096, Thinking: NewThinkingConfig(2048), Temperature: &warm},
+			expectedError: "temperature may only be set to 1 when thinking is enabled",
+		},
+		{
+			name:          "top k",
+			payload:       MessagePayload{MaxTokens: 4096, Thinking: NewThinkingConfig(2048), TopK: &topK},
+			expectedError: "top_k may not be set when thinking is enabled",
+		},
+		{
+			name:          "top p",
+			payload:       MessagePayload{MaxTokens: 4096, Thinking: NewThinkingConfig(2048), TopP: &lowTopP},
+			expectedError: "top_p must be between 0.95 and 1 when thinking is enabled",
+		},
+		{
+			name: "forced tool",
+			payload: MessagePayload{
+				MaxTokens:  4096,
+				Thinking:   NewThinkingConfig(2048),
+				Tools:      []Tool{{Name: "a", InputSchema: map[string]any{}}},
+				ToolChoice: &ToolChoice{Type: ToolChoiceAny},
+			},
+			expectedError: `tool_choice "any" may not be used when thinking is enabled`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.payload.validate()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMessageResponse_ThinkingRoundTrip(t *testing.T) {
+	var resp MessageResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"content": [
+			{"type": "thinking", "thinking": "Let me think.", "signature": "sig"},
+			{"type": "redacted_thinking", "data": "opaque"},
+			{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {}}
+		],
+		"stop_reason": "tool_use"
+	}`), &resp))
+
+	assert.Equal(t, "Let me think.", resp.Thinking())
+
+	data, err := json.Marshal(resp.ToMessage())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role": "assistant", "content": [
+		{"type": "thinking", "thinking": "Let me think.", "signature": "sig"},
+		{"type": "redacted_thinking", "data": "opaque"},
+		{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {}}
+	]}`, string(data))
+}
+
+func TestMessageSSEDecoder_Thinking(t *testing.T) {
+	input := `event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "thinking", "thinking": ""}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "thinking_delta", "thinking": "Step one."}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "signature_delta", "signature": "sig"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 1, "content_block": {"type": "text", "text": ""}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "text_delta", "text": "Answer"}}
+
+event: message_stop
+data: {"type": "message_stop"}
+`
+
+	decoder := NewMessageSSEDecoder(strings.NewReader(input))
+
+	var events []*MessageEventPayload
+	for {
+		event, err := decoder.Decode()
+		require.NoError(t, err)
+		if event == nil {
+			break
+		}
+		events = append(events, event)
+	}
+	require.Len(t, events, 7)
+
+	assert.Equal(t, "Step one.", events[1].Data.Thinking)
+	assert.Empty(t, events[1].Data.Content)
+	assert.Equal(t, "sig", events[2].Data.Data.(ContentBlockDelta).Delta.Signature)
+	assert.Equal(t, "Answer", events[5].Data.Content)
+	assert.Empty(t, events[5].Data.Thinking)
+
+	decoder = NewMessageSSEDecoder(strings.NewReader(input))
+	var content []string
+	for {
+		event, err := decoder.Decode(DecodeOptions{ContentOnly: true})
+		require.NoError(t, err)
+		if event == nil {
+			break
+		}
+		content = append(content, event.Data.Content)
+	}
+	assert.Equal(t, []string{"Answer", ""}, content)
+}
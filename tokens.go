@@ -0,0 +1,113 @@
+package anthrogo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const RequestTypeCountTokens = "messages/count_tokens"
+
+// TokenCount is the response of the token counting endpoint.
+type TokenCount struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// ContextWindowExceededError is returned by MessageRequest and MessageStreamRequest when
+// the pre-flight check finds that the input tokens plus MaxTokens do not fit in the
+// context window of the model.
+type ContextWindowExceededError struct {
+	Model         AnthropicModel
+	InputTokens   int
+	MaxTokens     int
+	ContextWindow int
+}
+
+// Error describes the tokens that do not fit in the context window.
+func (e *ContextWindowExceededError) Error() string {
+	return fmt.Sprintf("input tokens (%d) plus max_tokens (%d) exceed the context window of %s (%d)",
+		e.InputTokens, e.MaxTokens, e.Model, e.ContextWindow)
+}
+
+// countTokensPayload is the part of a MessagePayload accepted by the token counting
+// endpoint, which rejects max_tokens and the sampling options.
+type countTokensPayload struct {
+	Model      AnthropicModel  `json:"model"`
+	Messages   []Message       `json:"messages"`
+	System     any             `json:"system,omitempty"`
+	Tools      []Tool          `json:"tools,omitempty"`
+	ToolChoice *ToolChoice     `json:"tool_choice,omitempty"`
+	Thinking   *ThinkingConfig `json:"thinking,omitempty"`
+}
+
+// WithPreflightTokenCheck is an option to count the input tokens of each message request
+// before sending it. Requests whose input tokens plus MaxTokens exceed the context window
+// of the model fail with a *ContextWindowExceededError instead of being rejected by the
+// API. It costs an extra round trip per request. Requests to models that are not in the
+// model registry of the client fail, since their context window is not known.
+func WithPreflightTokenCheck() func(*Client) {
+	return func(c *Client) {
+		c.preflightTokenCheck = true
+	}
+}
+
+// CountTokens returns the number of input tokens the payload would use, including its
+// system prompt, tools, images, documents and thinking configuration. MaxTokens, Stream
+// and the sampling options are ignored.
+func (c *Client) CountTokens(ctx context.Context, payload MessagePayload) (TokenCount, error) {
+	var count TokenCount
+
+	if payload.System != nil && len(payload.SystemBlocks) > 0 {
+		return count, errors.New("only one of System and SystemBlocks may be set")
+	}
+	if err := validateTools(payload.Tools, payload.ToolChoice); err != nil {
+		return count, err
+	}
+	if err := payload.validateSources(); err != nil {
+		return count, err
+	}
+
+	body := countTokensPayload{
+		Model:      payload.Model,
+		Messages:   payload.Messages,
+		Tools:      payload.Tools,
+		ToolChoice: payload.ToolChoice,
+		Thinking:   payload.Thinking,
+	}
+	if len(payload.SystemBlocks) > 0 {
+		body.System = payload.SystemBlocks
+	} else if payload.System != nil {
+		body.System = *payload.System
+	}
+
+	err := c.doJSON(ctx, http.MethodPost, RequestTypeCountTokens, body, &count, payload.requestOptions()...)
+	return count, err
+}
+
+// checkContextWindow counts the input tokens of the payload and checks that they fit in
+// the context window of the model along with MaxTokens. It fails for models that are not in
+// the registry, since their context window is not known.
+func (c *Client) checkContextWindow(ctx context.Context, payload MessagePayload) error {
+	capabilities, ok := c.models.Lookup(payload.Model)
+	if !ok {
+		return fmt.Errorf("context window of model %s is not known, register it to use the pre-flight token check", payload.Model)
+	}
+	window := capabilities.ContextWindow
+
+	count, err := c.CountTokens(ctx, payload)
+	if err != nil {
+		return fmt.Errorf("counting tokens: %w", err)
+	}
+
+	if count.InputTokens+payload.MaxTokens > window {
+		return &ContextWindowExceededError{
+			Model:         payload.Model,
+			InputTokens:   count.InputTokens,
+			MaxTokens:     payload.MaxTokens,
+			ContextWindow: window,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_CountTokens(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages/count_tokens", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"model": "claude-3-5-sonnet-20240620",
+			"system": [{"type": "text", "text": "Be brief.", "cache_control": {"type": "ephemeral"}}],
+			"messages": [{"role": "user", "content": [
+				{"type": "image", "source": {"type": "url", "url": "https://cdn.example.com/cat.jpg"}},
+				{"type": "document", "source": {"type": "text", "media_type": "text/plain", "data": "notes"}},
+				{"type": "text", "text": "Describe"}
+			]}],
+			"tools": [{"name": "lookup", "input_schema": {"type": "object"}}],
+			"tool_choice": {"type": "auto"},
+			"thinking": {"type": "enabled", "budget_tokens": 2048}
+		}`, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"input_tokens": 1234}`))
+	}))
+	defer ts.Close()
+
+	system := NewTextContent("Be brief.")
+	system.CacheControl = NewEphemeralCacheControl("")
+	temperature := 0.5
+
+	count, err := newTestClient(t, ts.URL).CountTokens(context.Background(), MessagePayload{
+		Model:        ModelClaude3Dot5Sonnet,
+		SystemBlocks: []MessageContent{system},
+		Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{
+			NewImageContent(NewURLImageSource("https://cdn.example.com/cat.jpg")),
+			NewDocumentContent(NewTextDocumentSource("notes"), "", false),
+			NewTextContent("Describe"),
+		}}},
+		Tools:       []Tool{{Name: "lookup", InputSchema: map[string]any{"type": "object"}}},
+		ToolChoice:  &ToolChoice{Type: ToolChoiceAuto},
+		Thinking:    NewThinkingConfig(2048),
+		MaxTokens:   100,
+		Temperature: &temperature,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TokenCount{InputTokens: 1234}, count)
+}
+
+func TestClient_CountTokensValidation(t *testing.T) {
+	client := newTestClient(t, "http://127.0.0.1:0")
+
+	_, err := client.CountTokens(context.Background(), MessagePayload{
+		Model:    ModelClaude3Haiku,
+		Messages: []Message{{Role: RoleTypeUser, Content: []MessageContent{NewImageContent(NewFileImageSource(""))}}},
+	})
+	assert.EqualError(t, err, "message 0 block 0: file image has no file_id")
+}
+
+func TestClient_PreflightTokenCheck(t *testing.T) {
+	testCases := []struct {
+		name          string
+		model         AnthropicModel
+		inputTokens   int
+		expectedCalls []string
+		expectedError string
+		exceeded      *ContextWindowExceededError
+	}{
+		{
+			name:          "fits",
+			model:         ModelClaude3Haiku,
+			inputTokens:   1000,
+			expectedCalls: []string{"/messages/count_tokens", "/messages"},
+		},
+		{
+			name:          "exceeds",
+			model:         ModelClaude3Haiku,
+			inputTokens:   199_000,
+			expectedCalls: []string{"/messages/count_tokens"},
+			expectedError: "input tokens (199000) plus max_tokens (4096) exceed the context window of claude-3-haiku-20240307 (200000)",
+			exceeded: &ContextWindowExceededError{
+				Model:         ModelClaude3Haiku,
+				InputTokens:   199_000,
+				MaxTokens:     4096,
+				ContextWindow: 200_000,
+			},
+		},
+		{
+			name:          "unknown model",
+			model:         "claude-future",
+			inputTokens:   1_000_000,
+			expectedError: "context window of model claude-future is not known, register it to use the pre-flight token check",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.URL.Path)
+
+				if r.URL.Path == "/messages/count_tokens" {
+					var payload map[string]any
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+					assert.NotContains(t, payload, "max_tokens")
+					assert.NotContains(t, payload, "stream")
+
+					fmt.Fprintf(w, `{"input_tokens": %d}`, tc.inputTokens)
+					return
+				}
+
+				w.Write([]byte(`{"id": "1", "content": [], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+			}))
+			defer ts.Close()
+
+			client, err := NewClient(WithApiKey("fake-key"), WithPreflightTokenCheck())
+			require.NoError(t, err)
+			client.baseURL = ts.URL + "/"
+
+			_, err = client.MessageRequest(context.Background(), MessagePayload{
+				Model:     tc.model,
+				MaxTokens: 4096,
+				Messages:  conversation("hello"),
+			})
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.exceeded != nil {
+				var exceeded *ContextWindowExceededError
+				require.ErrorAs(t, err, &exceeded)
+				assert.Equal(t, tc.exceeded, exceeded)
+			}
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxToolIterations is the number of requests a ToolRunner makes before giving up.
+const DefaultMaxToolIterations = 10
+
+// ErrMaxToolIterations is returned by ToolRunner.Run when the model is still calling
+// tools after MaxIterations requests.
+var ErrMaxToolIterations = errors.New("tool runner reached the maximum number of iterations")
+
+// ToolFunc executes a single tool call. It receives the input of the tool_use block and
+// returns the content of the tool_result. A returned error is reported to the model as
+// an is_error result rather than stopping the run.
+type ToolFunc func(ctx context.Context, input json.RawMessage) ([]MessageContent, error)
+
+// ToolHandler pairs a tool definition with the function that executes it.
+type ToolHandler struct {
+	Tool Tool
+	Func ToolFunc
+}
+
+// ToolRunner repeatedly sends a message request, executes the tools the model asks for and
+// sends the results back until the model stops calling tools.
+type ToolRunner struct {
+	client   *Client
+	tools    []Tool
+	handlers map[string]ToolFunc
+
+	// MaxIterations caps the number of requests made by a single Run.
+	MaxIterations int
+}
+
+// ToolRunResult is the outcome of ToolRunner.Run.
+type ToolRunResult struct {
+	// Messages is the full conversation: the messages of the original payload followed
+	// by every assistant turn and tool_result turn of the run.
+	Messages []Message
+	// Response is the last response received from the model.
+	Response MessageResponse
+	// Usage is the sum of the usage of every request made.
+	Usage Usage
+	// Iterations is the number of requests made.
+	Iterations int
+}
+
+// NewToolRunner creates a ToolRunner that executes the given handlers.
+func NewToolRunner(client *Client, handlers ...ToolHandler) (*ToolRunner, error) {
+	runner := &ToolRunner{
+		client:        client,
+		handlers:      make(map[string]ToolFunc, len(handlers)),
+		MaxIterations: DefaultMaxToolIterations,
+	}
+
+	for _, handler := range handlers {
+		if handler.Func == nil {
+			return nil, fmt.Errorf("tool %q has no handler function", handler.Tool.Name)
+		}
+		if _, exists := runner.handlers[handler.Tool.Name]; exists {
+			return nil, fmt.Errorf("duplicate tool name %q", handler.Tool.Name)
+		}
+		runner.handlers[handler.Tool.Name] = handler.Func
+		runner.tools = append(runner.tools, handler.Tool)
+	}
+
+	if err := validateTools(runner.tools, nil); err != nil {
+		return nil, err
+	}
+
+	return runner, nil
+}
+
+// Run sends the payload and keeps answering tool calls until the model ends its turn, the
+// iteration cap is hit or the context is canceled. The handlers' tool definitions are added
+// to the payload unless a tool of the same name is already present. The result is returned
+// even when err is non-nil so that the partial transcript and usage are not lost.
+func (r *ToolRunner) Run(ctx context.Context, payload MessagePayload) (ToolRunResult, error) {
+	var result ToolRunResult
+
+	payload.Tools = r.mergeTools(payload.Tools)
+	payload.Messages = append([]Message(nil), payload.Messages...)
+	result.Messages = payload.Messages
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if result.Iterations >= r.MaxIterations {
+			return result, ErrMaxToolIterations
+		}
+
+		resp, err := r.client.MessageRequest(ctx, payload)
+		if err != nil {
+			return result, err
+		}
+
+		result.Iterations++
+		result.Response = resp
+		result.Usage.add(resp.Usage)
+		payload.Messages = append(payload.Messages, resp.ToMessage())
+		result.Messages = payload.Messages
+
+		uses := resp.ToolUses()
+		if resp.StopReason != StopReasonToolUse || len(uses) == 0 {
+			return result, nil
+		}
+
+		results := r.execute(ctx, uses)
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		payload.Messages = append(payload.Messages, Message{Role: RoleTypeUser, Content: results})
+		result.Messages = payload.Messages
+	}
+}
+
+// mergeTools returns the payload tools followed by every handler tool not already present.
+func (r *ToolRunner) mergeTools(tools []Tool) []Tool {
+	merged := append([]Tool(nil), tools...)
+
+	present := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		present[tool.Name] = true
+	}
+
+	for _, tool := range r.tools {
+		if !present[tool.Name] {
+			merged = append(merged, tool)
+		}
+	}
+
+	return merged
+}
+
+// execute runs every tool call concurrently and returns the tool_result blocks in the order
+// of the calls.
+func (r *ToolRunner) execute(ctx context.Context, uses []ContentBlock) []MessageContent {
+	results := make([]MessageContent, len(uses))
+
+	var wg sync.WaitGroup
+	for i, use := range uses {
+		wg.Add(1)
+		go func(i int, use ContentBlock) {
+			defer wg.Done()
+			results[i] = r.call(ctx, use)
+		}(i, use)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// call runs a single tool call, turning errors and panics into an is_error result.
+func (r *ToolRunner) call(ctx context.Context, use ContentBlock) (result MessageContent) {
+	handler, ok := r.handlers[use.Name]
+	if !ok {
+		return NewToolErrorContent(use.ID, fmt.Sprintf("unknown tool %q", use.Name))
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			result = NewToolErrorContent(use.ID, fmt.Sprintf("tool %q panicked: %v", use.Name, p))
+		}
+	}()
+
+	input := use.Input
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+
+	content, err := handler(ctx, input)
+	if err != nil {
+		return NewToolErrorContent(use.ID, err.Error())
+	}
+
+	return NewToolResultContent(use.ID, content...)
+}
@@ -0,0 +1,177 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedServer replies to successive /messages requests with the given responses and
+// records the payloads it received.
+func scriptedServer(t *testing.T, responses ...MessageResponse) (*httptest.Server, *[]MessagePayload) {
+	var (
+		mu       sync.Mutex
+		payloads []MessagePayload
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var payload MessagePayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+
+		require.LessOrEqual(t, len(payloads), len(responses), "unexpected request")
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(responses[len(payloads)-1]))
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, &payloads
+}
+
+func toolUseResponse(usage Usage, uses ...ContentBlock) MessageResponse {
+	return MessageResponse{
+		ID:         "msg",
+		Role:       RoleTypeAssistant,
+		Content:    uses,
+		StopReason: StopReasonToolUse,
+		Usage:      usage,
+	}
+}
+
+func endTurnResponse(text string, usage Usage) MessageResponse {
+	return MessageResponse{
+		ID:         "msg",
+		Role:       RoleTypeAssistant,
+		Content:    []ContentBlock{{Type: "text", Text: text}},
+		StopReason: StopReasonEndTurn,
+		Usage:      usage,
+	}
+}
+
+func newTestClient(t *testing.T, baseURL string) *Client {
+	client, err := NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+	client.baseURL = baseURL + "/"
+	return client
+}
+
+var echoTool = ToolHandler{
+	Tool: Tool{Name: "echo", InputSchema: map[string]any{"type": "object"}},
+	Func: func(ctx context.Context, input json.RawMessage) ([]MessageContent, error) {
+		return []MessageContent{NewTextContent(string(input))}, nil
+	},
+}
+
+var failTool = ToolHandler{
+	Tool: Tool{Name: "fail", InputSchema: map[string]any{"type": "object"}},
+	Func: func(ctx context.Context, input json.RawMessage) ([]MessageContent, error) {
+		return nil, errors.New("boom")
+	},
+}
+
+func TestToolRunner_Run(t *testing.T) {
+	ts, payloads := scriptedServer(t,
+		toolUseResponse(Usage{InputTokens: 10, OutputTokens: 5},
+			ContentBlock{Type: "tool_use", ID: "a", Name: "echo", Input: json.RawMessage(`{"x":1}`)},
+			ContentBlock{Type: "tool_use", ID: "b", Name: "fail", Input: json.RawMessage(`{}`)},
+			ContentBlock{Type: "tool_use", ID: "c", Name: "missing", Input: json.RawMessage(`{}`)},
+		),
+		endTurnResponse("done", Usage{InputTokens: 20, OutputTokens: 3}),
+	)
+
+	runner, err := NewToolRunner(newTestClient(t, ts.URL), echoTool, failTool)
+	require.NoError(t, err)
+
+	original := []Message{{Role: RoleTypeUser, Content: []MessageContent{NewTextContent("go")}}}
+	result, err := runner.Run(context.Background(), MessagePayload{
+		Model:     ModelClaude3Dot5Sonnet,
+		Messages:  original,
+		MaxTokens: 100,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Iterations)
+	assert.Equal(t, Usage{InputTokens: 30, OutputTokens: 8}, result.Usage)
+	assert.Equal(t, "done", result.Response.Content[0].Text)
+	assert.Len(t, original, 1)
+
+	require.Len(t, result.Messages, 4)
+	assert.Equal(t, RoleTypeAssistant, result.Messages[1].Role)
+	assert.Equal(t, RoleTypeUser, result.Messages[2].Role)
+	assert.Equal(t, RoleTypeAssistant, result.Messages[3].Role)
+
+	toolResults := result.Messages[2].Content
+	require.Len(t, toolResults, 3)
+	assert.Equal(t, NewToolResultContent("a", NewTextContent(`{"x":1}`)), toolResults[0])
+	assert.Equal(t, NewToolErrorContent("b", "boom"), toolResults[1])
+	assert.Equal(t, NewToolErrorContent("c", `unknown tool "missing"`), toolResults[2])
+
+	require.Len(t, *payloads, 2)
+	first := (*payloads)[0]
+	require.Len(t, first.Tools, 2)
+	assert.Equal(t, "echo", first.Tools[0].Name)
+	assert.Equal(t, "fail", first.Tools[1].Name)
+	assert.Len(t, (*payloads)[1].Messages, 3)
+}
+
+func TestToolRunner_MaxIterations(t *testing.T) {
+	use := ContentBlock{Type: "tool_use", ID: "a", Name: "echo", Input: json.RawMessage(`{}`)}
+	ts, _ := scriptedServer(t,
+		toolUseResponse(Usage{OutputTokens: 1}, use),
+		toolUseResponse(Usage{OutputTokens: 1}, use),
+	)
+
+	runner, err := NewToolRunner(newTestClient(t, ts.URL), echoTool)
+	require.NoError(t, err)
+	runner.MaxIterations = 2
+
+	result, err := runner.Run(context.Background(), MessagePayload{Model: ModelClaude3Dot5Sonnet, MaxTokens: 100})
+	assert.ErrorIs(t, err, ErrMaxToolIterations)
+	assert.Equal(t, 2, result.Iterations)
+	assert.Equal(t, 2, result.Usage.OutputTokens)
+	assert.Len(t, result.Messages, 4)
+}
+
+func TestToolRunner_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancelTool := ToolHandler{
+		Tool: Tool{Name: "cancel", InputSchema: map[string]any{"type": "object"}},
+		Func: func(ctx context.Context, input json.RawMessage) ([]MessageContent, error) {
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+
+	ts, payloads := scriptedServer(t,
+		toolUseResponse(Usage{}, ContentBlock{Type: "tool_use", ID: "a", Name: "cancel"}),
+	)
+
+	runner, err := NewToolRunner(newTestClient(t, ts.URL), cancelTool)
+	require.NoError(t, err)
+
+	result, err := runner.Run(ctx, MessagePayload{Model: ModelClaude3Dot5Sonnet, MaxTokens: 100})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, result.Iterations)
+	assert.Len(t, *payloads, 1)
+}
+
+func TestNewToolRunner_Errors(t *testing.T) {
+	client := newTestClient(t, "http://localhost")
+
+	_, err := NewToolRunner(client, echoTool, echoTool)
+	assert.EqualError(t, err, `duplicate tool name "echo"`)
+
+	_, err = NewToolRunner(client, ToolHandler{Tool: echoTool.Tool})
+	assert.EqualError(t, err, `tool "echo" has no handler function`)
+}
@@ -0,0 +1,149 @@
+package anthrogo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ToolChoiceType controls whether and how the model uses the provided tools.
+type ToolChoiceType string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool.
+	ToolChoiceAuto ToolChoiceType = "auto"
+	// ToolChoiceAny forces the model to call one of the tools.
+	ToolChoiceAny ToolChoiceType = "any"
+	// ToolChoiceTool forces the model to call the tool named in ToolChoice.Name.
+	ToolChoiceTool ToolChoiceType = "tool"
+	// ToolChoiceNone prevents the model from calling any tool.
+	ToolChoiceNone ToolChoiceType = "none"
+)
+
+// Tool is the definition of a tool the model may call. InputSchema is a JSON
+// schema object describing the input the tool expects; it may be any value that
+// marshals to such an object (a map, a json.RawMessage, ...).
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+	// CacheControl marks the tool definitions up to this one as a prompt-cache breakpoint.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// ToolChoice tells the model how to use the tools in the request.
+type ToolChoice struct {
+	Type ToolChoiceType `json:"type"`
+	// Name of the tool to use, only valid with ToolChoiceTool.
+	Name string `json:"name,omitempty"`
+	// Limit the model to at most one tool call (auto) or exactly one (any, tool).
+	DisableParallelToolUse *bool `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// NewTextContent returns a text content block.
+func NewTextContent(text string) MessageContent {
+	return MessageContent{Type: ContentTypeText, Text: &text}
+}
+
+// NewToolResultContent returns a tool_result block answering the tool_use block with the
+// given id. Content is usually one or more text blocks but may include images.
+func NewToolResultContent(toolUseID string, content ...MessageContent) MessageContent {
+	return MessageContent{
+		Type:      ContentTypeToolResult,
+		ToolUseID: toolUseID,
+		Content:   content,
+	}
+}
+
+// NewToolErrorContent returns a tool_result block that tells the model the tool call failed.
+func NewToolErrorContent(toolUseID string, message string) MessageContent {
+	result := NewToolResultContent(toolUseID, NewTextContent(message))
+	result.IsError = true
+	return result
+}
+
+// ToolUses returns the tool_use blocks of the response in the order the model produced them.
+func (r MessageResponse) ToolUses() []ContentBlock {
+	var uses []ContentBlock
+	for _, block := range r.Content {
+		if block.Type == string(ContentTypeToolUse) {
+			uses = append(uses, block)
+		}
+	}
+	return uses
+}
+
+// ToMessage converts the response into an assistant Message so that it can be appended
+// to the conversation, e.g. before replying with tool results.
+func (r MessageResponse) ToMessage() Message {
+	content := make([]MessageContent, 0, len(r.Content))
+	for _, block := range r.Content {
+		content = append(content, block.ToMessageContent())
+	}
+	return Message{Role: RoleTypeAssistant, Content: content}
+}
+
+// ToMessageContent converts a response block into the equivalent request block.
+func (b ContentBlock) ToMessageContent() MessageContent {
+	switch ContentType(b.Type) {
+	case ContentTypeToolUse:
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return MessageContent{Type: ContentTypeToolUse, ID: b.ID, Name: b.Name, Input: input}
+	case ContentTypeThinking:
+		thinking := b.Thinking
+		return MessageContent{Type: ContentTypeThinking, Thinking: &thinking, Signature: b.Signature}
+	case ContentTypeRedactedThinking:
+		return MessageContent{Type: ContentTypeRedactedThinking, Data: b.Data}
+	default:
+		text := b.Text
+		return MessageContent{Type: ContentType(b.Type), Text: &text}
+	}
+}
+
+// validateTools checks the tool definitions and tool choice of a request.
+func validateTools(tools []Tool, choice *ToolChoice) error {
+	names := make(map[string]bool, len(tools))
+	for i, tool := range tools {
+		if tool.Name == "" {
+			return fmt.Errorf("tool %d has no name", i)
+		}
+		if names[tool.Name] {
+			return fmt.Errorf("duplicate tool name %q", tool.Name)
+		}
+		if tool.InputSchema == nil {
+			return fmt.Errorf("tool %q has no input schema", tool.Name)
+		}
+		names[tool.Name] = true
+	}
+
+	if choice == nil {
+		return nil
+	}
+
+	switch choice.Type {
+	case ToolChoiceAuto, ToolChoiceAny:
+		if choice.Name != "" {
+			return fmt.Errorf("tool_choice %q does not take a tool name", choice.Type)
+		}
+	case ToolChoiceTool:
+		if !names[choice.Name] {
+			return fmt.Errorf("tool_choice names unknown tool %q", choice.Name)
+		}
+	case ToolChoiceNone:
+		if choice.Name != "" || choice.DisableParallelToolUse != nil {
+			return errors.New("tool_choice none does not take a tool name or disable_parallel_tool_use")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tool_choice type %q", choice.Type)
+	}
+
+	if len(tools) == 0 {
+		return fmt.Errorf("tool_choice %q requires at least one tool", choice.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package anthrogo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_MessageRequestToolUse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(body, &payload))
+
+		assert.Equal(t, []any{map[string]any{
+			"name":        "get_weather",
+			"description": "Get the weather for a city",
+			"input_schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		}}, payload["tools"])
+		assert.Equal(t, map[string]any{"type": "auto", "disable_parallel_tool_use": true}, payload["tool_choice"])
+
+		messages := payload["messages"].([]any)
+		require.Len(t, messages, 3)
+		assert.Equal(t, map[string]any{
+			"type":  "tool_use",
+			"id":    "toolu_1",
+			"name":  "get_weather",
+			"input": map[string]any{"city": "Paris"},
+		}, messages[1].(map[string]any)["content"].([]any)[0])
+		assert.Equal(t, map[string]any{
+			"type":        "tool_result",
+			"tool_use_id": "toolu_1",
+			"is_error":    true,
+			"content":     []any{map[string]any{"type": "text", "text": "service unavailable"}},
+		}, messages[2].(map[string]any)["content"].([]any)[0])
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "msg_1",
+			"type": "message",
+			"role": "assistant",
+			"content": [
+				{"type": "text", "text": "Let me try again."},
+				{"type": "tool_use", "id": "toolu_2", "name": "get_weather", "input": {"city": "Paris"}}
+			],
+			"model": "claude-3-5-sonnet-20240620",
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 20, "output_tokens": 12}
+		}`)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithApiKey("fake-key"))
+	require.NoError(t, err)
+	client.baseURL = ts.URL + "/"
+
+	disableParallel := true
+	payload := MessagePayload{
+		Model: ModelClaude3Dot5Sonnet,
+		Messages: []Message{
+			{Role: RoleTypeUser, Content: []MessageContent{NewTextContent("Weather in Paris?")}},
+			{Role: RoleTypeAssistant, Content: []MessageContent{{
+				Type:  ContentTypeToolUse,
+				ID:    "toolu_1",
+				Name:  "get_weather",
+				Input: json.RawMessage(`{"city":"Paris"}`),
+			}}},
+			{Role: RoleTypeUser, Content: []MessageContent{NewToolErrorContent("toolu_1", "service unavailable")}},
+		},
+		MaxTokens: 100,
+		Tools: []Tool{{
+			Name:        "get_weather",
+			Description: "Get the weather for a city",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		}},
+		ToolChoice: &ToolChoice{Type: ToolChoiceAuto, DisableParallelToolUse: &disableParallel},
+	}
+
+	resp, err := client.MessageRequest(context.Background(), payload)
+	require.NoError(t, err)
+
+	assert.Equal(t, StopReasonToolUse, resp.StopReason)
+	uses := resp.ToolUses()
+	require.Len(t, uses, 1)
+	assert.Equal(t, "toolu_2", uses[0].ID)
+	assert.Equal(t, "get_weather", uses[0].Name)
+	assert.JSONEq(t, `{"city":"Paris"}`, string(uses[0].Input))
+
+	msg := resp.ToMessage()
+	assert.Equal(t, RoleTypeAssistant, msg.Role)
+	require.Len(t, msg.Content, 2)
+	assert.Equal(t, "Let me try again.", *msg.Content[0].Text)
+	assert.Equal(t, ContentTypeToolUse, msg.Content[1].Type)
+	assert.Equal(t, "toolu_2", msg.Content[1].ID)
+}
+
+func TestValidateTools(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object"}`)
+	disable := true
+
+	testCases := []struct {
+		name          string
+		tools         []Tool
+		choice        *ToolChoice
+		expectedError string
+	}{
+		{
+			name:  "no choice",
+			tools: []Tool{{Name: "a", InputSchema: schema}},
+		},
+		{
+			name:   "named tool",
+			tools:  []Tool{{Name: "a", InputSchema: schema}},
+			choice: &ToolChoice{Type: ToolChoiceTool, Name: "a"},
+		},
+		{
+			name:   "none without tools",
+			choice: &ToolChoice{Type: ToolChoiceNone},
+		},
+		{
+			name:          "missing name",
+			tools:         []Tool{{InputSchema: schema}},
+			expectedError: "tool 0 has no name",
+		},
+		{
+			name:          "duplicate name",
+			tools:         []Tool{{Name: "a", InputSchema: schema}, {Name: "a", InputSchema: schema}},
+			expectedError: `duplicate tool name "a"`,
+		},
+		{
+			name:          "missing schema",
+			tools:         []Tool{{Name: "a"}},
+			expectedError: `tool "a" has no input schema`,
+		},
+		{
+			name:          "unknown named tool",
+			tools:         []Tool{{Name: "a", InputSchema: schema}},
+			choice:        &ToolChoice{Type: ToolChoiceTool, Name: "b"},
+			expectedError: `tool_choice names unknown tool "b"`,
+		},
+		{
+			name:          "any without tools",
+			choice:        &ToolChoice{Type: ToolChoiceAny},
+			expectedError: `tool_choice "any" requires at least one tool`,
+		},
+		{
+			name:          "none with parallel flag",
+			choice:        &ToolChoice{Type: ToolChoiceNone, DisableParallelToolUse: &disable},
+			expectedError: "tool_choice none does not take a tool name or disable_parallel_tool_use",
+		},
+		{
+			name:          "unknown type",
+			choice:        &ToolChoice{Type: "sometimes"},
+			expectedError: `unknown tool_choice type "sometimes"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTools(tc.tools, tc.choice)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}